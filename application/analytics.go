@@ -0,0 +1,215 @@
+package application
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/domain/service"
+	"github.com/mochisuna/linebot-sample/logger"
+	"github.com/mochisuna/linebot-sample/tracing"
+)
+
+// 推移の区間の既定値
+const defaultAnalyticsInterval = 5 * time.Minute
+
+// 推移の区間数の上限。長いイベントでは区間を広げて収める
+const maxTimelineBuckets = 288
+
+// 集計対象の投票。表示順に並べる
+var analyticsVotes = []domain.VOTE_STATUS{domain.GREAT, domain.GOOD, domain.NOT_GOOD, domain.BAD}
+
+type AnalyticsService struct {
+	eventRepo repository.EventRepository
+	userRepo  repository.UserRepository
+}
+
+// NewAnalyticsService inject eventRepo, userRepo
+func NewAnalyticsService(eventRepo repository.EventRepository, userRepo repository.UserRepository) service.AnalyticsService {
+	return &AnalyticsService{
+		eventRepo: eventRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// GetEventAnalytics はイベントの投票と参加状況を集計します
+// 集計はリポジトリから読み込んだ行に対して行うため、データベースの種類によらず同じ結果になる
+func (s *AnalyticsService) GetEventAnalytics(ctx context.Context, eventID domain.EventID, interval time.Duration) (*domain.Analytics, error) {
+	logger.FromContext(ctx).Debug("called application.GetEventAnalytics")
+	ctx, span := tracing.Start(ctx, "AnalyticsService.GetEventAnalytics")
+	defer span.End()
+	if _, err := s.eventRepo.SelectByEventID(ctx, eventID); err != nil {
+		return nil, err
+	}
+	participants, err := s.userRepo.SelectParticipants(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	votes, err := s.userRepo.SelectVotes(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	histories, err := s.userRepo.SelectVoteHistories(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = defaultAnalyticsInterval
+	}
+	analytics := summarizeVotes(participants, votes)
+	analytics.EventID = eventID
+	analytics.Interval, analytics.Timeline = timeline(participants, histories, int(interval/time.Second))
+	analytics.PeakActive = peakActive(participants)
+	return analytics, nil
+}
+
+// summarizeVotes は現在の投票から平均点、分布、ネットスコアと投票率を計算します
+func summarizeVotes(participants []domain.User, votes []domain.User) *domain.Analytics {
+	counts := map[domain.VOTE_STATUS]int{}
+	analytics := &domain.Analytics{
+		Participants: len(participants),
+	}
+	total := 0
+	for _, vote := range votes {
+		if vote.Vote.Score() == 0 {
+			continue
+		}
+		counts[vote.Vote]++
+		analytics.Voters++
+		total += vote.Vote.Score()
+	}
+	for _, vote := range analyticsVotes {
+		analytics.Distribution = append(analytics.Distribution, domain.VoteCount{
+			Vote:  vote,
+			Count: counts[vote],
+		})
+	}
+	if analytics.Participants > 0 {
+		analytics.ParticipationRate = float64(analytics.Voters) / float64(analytics.Participants)
+	}
+	if analytics.Voters > 0 {
+		analytics.MeanScore = float64(total) / float64(analytics.Voters)
+		promoters := counts[domain.GREAT]
+		detractors := counts[domain.NOT_GOOD] + counts[domain.BAD]
+		analytics.NetScore = float64(promoters-detractors) * 100 / float64(analytics.Voters)
+	}
+	return analytics
+}
+
+// peakActive は参加と離脱を時刻順に並べ、同時に参加していた人数の最大値を求めます
+// 同じ時刻の参加は離脱より先に数え、終了時の一斉離脱と同じ秒に参加したユーザーも含める
+// 参加の行は再参加しても created_at を保つため、再参加したユーザーは最初の参加から最後の離脱まで離れていた間も含めて数える
+func peakActive(participants []domain.User) int {
+	type change struct {
+		at    int
+		delta int
+	}
+	changes := make([]change, 0, len(participants)*2)
+	for _, p := range participants {
+		changes = append(changes, change{at: p.CreatedAt, delta: 1})
+		if !p.IsParticipated {
+			changes = append(changes, change{at: p.UpdatedAt, delta: -1})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].at != changes[j].at {
+			return changes[i].at < changes[j].at
+		}
+		return changes[i].delta > changes[j].delta
+	})
+	active, peak := 0, 0
+	for _, c := range changes {
+		active += c.delta
+		if active > peak {
+			peak = active
+		}
+	}
+	return peak
+}
+
+// timeline は参加、離脱と投票の履歴を interval 秒ごとの区間にまとめます
+// 参加時刻は最初の参加の created_at、離脱時刻は最後の離脱の updated_at を使う
+// 途中の離脱と再参加は記録されていないため、再参加したユーザーは1回の参加と離脱として数える
+func timeline(participants []domain.User, histories []domain.VoteHistory, interval int) (int, []domain.TimelineBucket) {
+	start, end := 0, 0
+	observe := func(t int) {
+		if t <= 0 {
+			return
+		}
+		if start == 0 || t < start {
+			start = t
+		}
+		if t > end {
+			end = t
+		}
+	}
+	for _, p := range participants {
+		observe(p.CreatedAt)
+		if !p.IsParticipated {
+			observe(p.UpdatedAt)
+		}
+	}
+	for _, h := range histories {
+		observe(h.CreatedAt)
+	}
+	if start == 0 {
+		return interval, nil
+	}
+	start -= start % interval
+	for (end-start)/interval+1 > maxTimelineBuckets {
+		interval *= 2
+		start -= start % interval
+	}
+
+	buckets := make([]domain.TimelineBucket, (end-start)/interval+1)
+	for i := range buckets {
+		buckets[i].Start = start + i*interval
+	}
+	index := func(t int) int {
+		return (t - start) / interval
+	}
+	for _, p := range participants {
+		if p.CreatedAt > 0 {
+			buckets[index(p.CreatedAt)].Joins++
+		}
+		if !p.IsParticipated && p.UpdatedAt > 0 {
+			buckets[index(p.UpdatedAt)].Leaves++
+		}
+	}
+
+	// 履歴を順に適用し、各区間の終わりの時点の平均点を求める
+	sorted := make([]domain.VoteHistory, 0, len(histories))
+	for _, h := range histories {
+		if h.CreatedAt > 0 {
+			sorted = append(sorted, h)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt < sorted[j].CreatedAt
+	})
+	current := map[domain.UserID]domain.VOTE_STATUS{}
+	active, total, voters, next := 0, 0, 0, 0
+	for i := range buckets {
+		active += buckets[i].Joins - buckets[i].Leaves
+		buckets[i].Active = active
+		for ; next < len(sorted) && index(sorted[next].CreatedAt) == i; next++ {
+			h := sorted[next]
+			if prev := current[h.UserID].Score(); prev > 0 {
+				total -= prev
+				voters--
+			}
+			if score := h.Vote.Score(); score > 0 {
+				total += score
+				voters++
+			}
+			current[h.UserID] = h.Vote
+			buckets[i].Changes++
+		}
+		if voters > 0 {
+			buckets[i].MeanScore = float64(total) / float64(voters)
+		}
+	}
+	return interval, buckets
+}
@@ -0,0 +1,161 @@
+package application
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mochisuna/linebot-sample/domain"
+)
+
+// joined は created_at に参加し、left が 0 でなければその時刻に離脱したユーザーを返します
+func joined(id domain.UserID, created, left int) domain.User {
+	if left == 0 {
+		return domain.User{ID: id, IsParticipated: true, CreatedAt: created, UpdatedAt: created}
+	}
+	return domain.User{ID: id, CreatedAt: created, UpdatedAt: left}
+}
+
+func TestPeakActive(t *testing.T) {
+	tests := []struct {
+		name         string
+		participants []domain.User
+		want         int
+	}{
+		{"empty", nil, 0},
+		{"all active", []domain.User{joined("a", 10, 0), joined("b", 20, 0)}, 2},
+		{"sequential", []domain.User{joined("a", 10, 20), joined("b", 30, 40)}, 1},
+		{"overlap", []domain.User{joined("a", 10, 30), joined("b", 20, 40), joined("c", 35, 0)}, 2},
+		// 参加と離脱が同じ時刻の場合は参加を先に数える
+		{"join and leave at the same time", []domain.User{joined("a", 10, 20), joined("b", 20, 30)}, 2},
+		{"closed in the same second", []domain.User{joined("a", 10, 10), joined("b", 10, 10)}, 2},
+		// a は 10 に参加し 20〜40 は離れていたが、再参加で created_at は変わらないため b と重なって数える
+		{"rejoined", []domain.User{joined("a", 10, 50), joined("b", 25, 35)}, 2},
+		{"rejoined and still active", []domain.User{{ID: "a", IsParticipated: true, CreatedAt: 10, UpdatedAt: 40}, joined("b", 25, 35)}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := peakActive(tt.participants); got != tt.want {
+				t.Errorf("peakActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeVotes(t *testing.T) {
+	participants := []domain.User{joined("a", 1, 0), joined("b", 1, 0), joined("c", 1, 0), joined("d", 1, 0), joined("e", 1, 0)}
+	tests := []struct {
+		name      string
+		votes     []domain.VOTE_STATUS
+		voters    int
+		rate      float64
+		mean      float64
+		netScore  float64
+		histogram []int
+	}{
+		{"no votes", []domain.VOTE_STATUS{domain.NOT_VOTED}, 0, 0, 0, 0, []int{0, 0, 0, 0}},
+		{"all great", []domain.VOTE_STATUS{domain.GREAT, domain.GREAT}, 2, 0.4, 4, 100, []int{2, 0, 0, 0}},
+		{"all bad", []domain.VOTE_STATUS{domain.BAD, domain.NOT_GOOD}, 2, 0.4, 1.5, -100, []int{0, 0, 1, 1}},
+		// GOOD は推奨にも批判にも数えない
+		{"mixed", []domain.VOTE_STATUS{domain.GREAT, domain.GOOD, domain.GOOD, domain.BAD, domain.NOT_VOTED}, 4, 0.8, 2.75, 0, []int{1, 2, 0, 1}},
+		{"positive", []domain.VOTE_STATUS{domain.GREAT, domain.GREAT, domain.GOOD, domain.NOT_GOOD}, 4, 0.8, 3.25, 25, []int{2, 1, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			votes := make([]domain.User, len(tt.votes))
+			for i, v := range tt.votes {
+				votes[i] = domain.User{ID: participants[i].ID, Vote: v}
+			}
+			got := summarizeVotes(participants, votes)
+			if got.Participants != len(participants) || got.Voters != tt.voters {
+				t.Errorf("Participants, Voters = %v, %v, want %v, %v", got.Participants, got.Voters, len(participants), tt.voters)
+			}
+			if got.ParticipationRate != tt.rate || got.MeanScore != tt.mean || got.NetScore != tt.netScore {
+				t.Errorf("ParticipationRate, MeanScore, NetScore = %v, %v, %v, want %v, %v, %v", got.ParticipationRate, got.MeanScore, got.NetScore, tt.rate, tt.mean, tt.netScore)
+			}
+			histogram := make([]int, len(got.Distribution))
+			for i, c := range got.Distribution {
+				if c.Vote != analyticsVotes[i] {
+					t.Errorf("Distribution[%v].Vote = %v, want %v", i, c.Vote, analyticsVotes[i])
+				}
+				histogram[i] = c.Count
+			}
+			if !reflect.DeepEqual(histogram, tt.histogram) {
+				t.Errorf("Distribution = %v, want %v", histogram, tt.histogram)
+			}
+		})
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	tests := []struct {
+		name         string
+		participants []domain.User
+		histories    []domain.VoteHistory
+		interval     int
+		wantInterval int
+		want         []domain.TimelineBucket
+	}{
+		{
+			name:         "empty",
+			interval:     60,
+			wantInterval: 60,
+		},
+		{
+			name:         "joins, leaves and votes",
+			participants: []domain.User{joined("a", 1010, 1130), joined("b", 1070, 0)},
+			histories: []domain.VoteHistory{
+				{UserID: "a", Vote: domain.GREAT, CreatedAt: 1020},
+				{UserID: "b", Vote: domain.BAD, CreatedAt: 1080},
+				// 変更前の投票は平均から除く
+				{UserID: "a", Vote: domain.GOOD, PreviousVote: domain.GREAT, CreatedAt: 1090},
+			},
+			interval:     60,
+			wantInterval: 60,
+			want: []domain.TimelineBucket{
+				{Start: 960, Joins: 1, Active: 1},
+				{Start: 1020, Joins: 1, Active: 2, Changes: 1, MeanScore: 4},
+				{Start: 1080, Leaves: 1, Active: 1, Changes: 2, MeanScore: 2},
+			},
+		},
+		{
+			// 1000 に参加し、1070 に離脱して 1130 に再参加、1190 に離脱したユーザー
+			name:         "rejoined",
+			participants: []domain.User{joined("a", 1000, 1190)},
+			interval:     60,
+			wantInterval: 60,
+			want: []domain.TimelineBucket{
+				{Start: 960, Joins: 1, Active: 1},
+				{Start: 1020, Active: 1},
+				{Start: 1080, Active: 1},
+				{Start: 1140, Leaves: 1, Active: 0},
+			},
+		},
+		{
+			name:         "widened to fit the bucket limit",
+			participants: []domain.User{joined("a", 60, 60*maxTimelineBuckets+60)},
+			interval:     60,
+			wantInterval: 120,
+			want: func() []domain.TimelineBucket {
+				buckets := make([]domain.TimelineBucket, maxTimelineBuckets/2+1)
+				for i := range buckets {
+					buckets[i] = domain.TimelineBucket{Start: i * 120, Active: 1}
+				}
+				buckets[0].Joins = 1
+				buckets[len(buckets)-1].Leaves = 1
+				buckets[len(buckets)-1].Active = 0
+				return buckets
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interval, got := timeline(tt.participants, tt.histories, tt.interval)
+			if interval != tt.wantInterval {
+				t.Errorf("interval = %v, want %v", interval, tt.wantInterval)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("timeline() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,45 +2,77 @@ package application
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"math/big"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mochisuna/linebot-sample/domain"
 	"github.com/mochisuna/linebot-sample/domain/repository"
 	"github.com/mochisuna/linebot-sample/domain/service"
+	"github.com/mochisuna/linebot-sample/logger"
+	"github.com/mochisuna/linebot-sample/tracing"
 
 	"github.com/rs/xid"
 )
 
+// 招待コードは口頭でも伝えやすいよう紛らわしい文字を除外
+const inviteCodeLetters = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const inviteCodeLength = 8
+
+// 参加コードの衝突時に再生成する回数
+const joinCodeRetry = 10
+
 type CallbackService struct {
-	eventRepo repository.EventRepository
-	ownerRepo repository.OwnerRepository
-	userRepo  repository.UserRepository
+	tx            repository.TxManager
+	eventRepo     repository.EventRepository
+	ownerRepo     repository.OwnerRepository
+	userRepo      repository.UserRepository
+	organizerRepo repository.OrganizerRepository
+	commentRepo   repository.CommentRepository
 }
 
 // NewCallbackService inject eventRepo
-func NewCallbackService(eventRepo repository.EventRepository, ownerRepo repository.OwnerRepository, userRepo repository.UserRepository) service.CallbackService {
+func NewCallbackService(tx repository.TxManager, eventRepo repository.EventRepository, ownerRepo repository.OwnerRepository, userRepo repository.UserRepository, organizerRepo repository.OrganizerRepository, commentRepo repository.CommentRepository) service.CallbackService {
 	return &CallbackService{
-		eventRepo: eventRepo,
-		ownerRepo: ownerRepo,
-		userRepo:  userRepo,
+		tx:            tx,
+		eventRepo:     eventRepo,
+		ownerRepo:     ownerRepo,
+		userRepo:      userRepo,
+		organizerRepo: organizerRepo,
+		commentRepo:   commentRepo,
 	}
 }
 
-func (s *CallbackService) Follow(ctx context.Context, ownerID domain.OwnerID) (*domain.Owner, error) {
-	log.Println("called application.Follow")
+func (s *CallbackService) Follow(ctx context.Context, ownerID domain.OwnerID, displayName string) (*domain.Owner, error) {
+	logger.FromContext(ctx).Debug("called application.Follow")
+	ctx, span := tracing.Start(ctx, "CallbackService.Follow")
+	defer span.End()
 	now := int(time.Now().Unix())
 	owner := &domain.Owner{
-		ID:        ownerID,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:          ownerID,
+		DisplayName: displayName,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
 
-	_, err := s.ownerRepo.Select(ownerID)
+	ret, err := s.ownerRepo.Select(ctx, ownerID)
 	if err != nil && err == sql.ErrNoRows {
-		err := s.ownerRepo.WithTransaction(ctx, func(tx *sql.Tx) error {
-			return s.ownerRepo.Create(owner, tx)
+		err := s.tx.Do(ctx, func(ctx context.Context) error {
+			return s.ownerRepo.Create(ctx, owner)
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if err == nil && ret.DisplayName != displayName {
+		// 再フォロー時は表示名だけ最新にしておく
+		owner.CreatedAt = ret.CreatedAt
+		err := s.tx.Do(ctx, func(ctx context.Context) error {
+			return s.ownerRepo.Update(ctx, owner)
 		})
 		if err != nil {
 			return nil, err
@@ -49,55 +81,154 @@ func (s *CallbackService) Follow(ctx context.Context, ownerID domain.OwnerID) (*
 	return owner, nil
 }
 
-func (s *CallbackService) GetEventByOwnerID(ownerID domain.OwnerID, status domain.EventStatus) (*domain.Event, error) {
-	log.Println("called application.GetEventByOwnerID")
-	return s.eventRepo.SelectByOwnerID(ownerID, &status)
+func (s *CallbackService) GetEventByOwnerID(ctx context.Context, ownerID domain.OwnerID, status domain.EventStatus) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called application.GetEventByOwnerID")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetEventByOwnerID")
+	defer span.End()
+	return s.eventRepo.SelectByOwnerID(ctx, ownerID, &status)
+}
+
+func (s *CallbackService) GetEventByOrganizerID(ctx context.Context, ownerID domain.OwnerID, status domain.EventStatus) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called application.GetEventByOrganizerID")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetEventByOrganizerID")
+	defer span.End()
+	return s.eventRepo.SelectByOrganizerID(ctx, ownerID, &status)
 }
 
 func (s *CallbackService) UpdateEventStatus(ctx context.Context, ownerID domain.OwnerID, status domain.EventStatus) (*domain.Event, error) {
-	log.Println("called application.UpdateEventStatus")
-	event, err := s.eventRepo.SelectByOwnerID(ownerID, nil)
+	logger.FromContext(ctx).Debug("called application.UpdateEventStatus")
+	ctx, span := tracing.Start(ctx, "CallbackService.UpdateEventStatus")
+	defer span.End()
+	// 開催はスタンバイ中のイベント、それ以外は開催中のイベントが対象
+	current := domain.EVENT_OPEN
+	if status == domain.EVENT_OPEN {
+		current = domain.EVENT_STABDBY
+	}
+	event, err := s.eventRepo.SelectByOrganizerID(ctx, ownerID, &current)
 	if err != nil {
 		return nil, err
 	}
 	event.UpdatedAt = int(time.Now().Unix())
 	event.Status = status
 
-	err = s.eventRepo.WithTransaction(ctx, func(tx *sql.Tx) error {
-		return s.eventRepo.Update(event, tx)
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.eventRepo.Update(ctx, event); err != nil {
+			return err
+		}
+		// 終了したイベントに参加者が残らないよう同じトランザクションで離脱させる
+		if status == domain.EVENT_CLOSED {
+			return s.userRepo.LeaveByEventID(ctx, event.ID, event.UpdatedAt)
+		}
+		return nil
 	})
 	return event, err
 }
 
-func (s *CallbackService) RegisterEvent(ctx context.Context, ownerID domain.OwnerID) (*domain.Event, error) {
-	log.Println("called application.RegisterEvent")
+// UpdateEventTitle はスタンバイ中のイベントのタイトルを変更します
+func (s *CallbackService) UpdateEventTitle(ctx context.Context, ownerID domain.OwnerID, title string) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called application.UpdateEventTitle")
+	ctx, span := tracing.Start(ctx, "CallbackService.UpdateEventTitle")
+	defer span.End()
+	status := domain.EVENT_STABDBY
+	event, err := s.eventRepo.SelectByOrganizerID(ctx, ownerID, &status)
+	if err != nil {
+		return nil, err
+	}
+	event.UpdatedAt = int(time.Now().Unix())
+	event.Title = title
+
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		return s.eventRepo.Update(ctx, event)
+	})
+	return event, err
+}
+
+// StartEvent はスタンバイ中のイベントを開催します。非公開の場合はパスコードを発行します
+func (s *CallbackService) StartEvent(ctx context.Context, ownerID domain.OwnerID, isPrivate bool) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called application.StartEvent")
+	ctx, span := tracing.Start(ctx, "CallbackService.StartEvent")
+	defer span.End()
+	status := domain.EVENT_STABDBY
+	event, err := s.eventRepo.SelectByOrganizerID(ctx, ownerID, &status)
+	if err != nil {
+		return nil, err
+	}
+	event.UpdatedAt = int(time.Now().Unix())
+	event.OpenedAt = event.UpdatedAt
+	event.Status = domain.EVENT_OPEN
+	event.IsPrivate = isPrivate
+	event.Passcode = ""
+	if isPrivate {
+		if event.Passcode, err = newDigits(domain.PasscodeLength); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		return s.eventRepo.Update(ctx, event)
+	})
+	return event, err
+}
+
+func (s *CallbackService) RegisterEvent(ctx context.Context, ownerID domain.OwnerID, title string) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called application.RegisterEvent")
+	ctx, span := tracing.Start(ctx, "CallbackService.RegisterEvent")
+	defer span.End()
+	code, err := s.newJoinCode(ctx)
+	if err != nil {
+		return nil, err
+	}
 	now := int(time.Now().Unix())
 	event := &domain.Event{
 		ID:        domain.EventID(xid.New().String()),
 		OwnerID:   ownerID,
 		Status:    domain.EVENT_STABDBY,
+		Title:     title,
+		JoinCode:  code,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 
-	err := s.eventRepo.WithTransaction(ctx, func(tx *sql.Tx) error {
-		return s.eventRepo.Create(event, tx)
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		return s.eventRepo.Create(ctx, event)
 	})
 	return event, err
 }
-func (s *CallbackService) GetParticipatedEvent(userID domain.UserID) (*domain.User, error) {
-	log.Println("called application.GetParticipatedEvent")
-	return s.userRepo.SelectByIDAndStatus(&userID, true)
+func (s *CallbackService) GetParticipatedEvent(ctx context.Context, userID domain.UserID) (*domain.User, error) {
+	logger.FromContext(ctx).Debug("called application.GetParticipatedEvent")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetParticipatedEvent")
+	defer span.End()
+	return s.userRepo.SelectByIDAndStatus(ctx, &userID, true)
 }
 
-func (s *CallbackService) GetActiveEvents() ([]domain.Event, error) {
-	log.Println("called application.GetActiveEvents")
+// GetUserContext はコマンドの判定に使うユーザーの状態をまとめて返します
+func (s *CallbackService) GetUserContext(ctx context.Context, userID domain.UserID) (*domain.UserContext, error) {
+	logger.FromContext(ctx).Debug("called application.GetUserContext")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetUserContext")
+	defer span.End()
+	return s.userRepo.SelectContext(ctx, userID)
+}
+
+// GetActiveEvents は開催中の公開イベントを新しい順に返します
+func (s *CallbackService) GetActiveEvents(ctx context.Context, offset, limit int) ([]domain.EventSummary, error) {
+	logger.FromContext(ctx).Debug("called application.GetActiveEvents")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetActiveEvents")
+	defer span.End()
 	status := domain.EVENT_OPEN
-	return s.eventRepo.SelectList(&status)
+	return s.eventRepo.SelectList(ctx, &domain.EventListQuery{
+		Status: &status,
+		Order:  domain.EVENT_ORDER_NEWEST,
+		Offset: offset,
+		Limit:  limit,
+	})
 }
 
+// ParticipateEvent はイベントに参加します
+// 参加状況の確認と登録は同じトランザクションで行い、同時に別のイベントへ参加した場合もDBの一意制約で弾きます
 func (s *CallbackService) ParticipateEvent(ctx context.Context, userID *domain.UserID, eventID *domain.EventID) error {
-	log.Println("called application.ParticipateEvent")
+	logger.FromContext(ctx).Debug("called application.ParticipateEvent")
+	ctx, span := tracing.Start(ctx, "CallbackService.ParticipateEvent")
+	defer span.End()
 	now := int(time.Now().Unix())
 	user := &domain.User{
 		ID:             *userID,
@@ -107,29 +238,72 @@ func (s *CallbackService) ParticipateEvent(ctx context.Context, userID *domain.U
 		CreatedAt:      now,
 		UpdatedAt:      now,
 	}
-	// not foundの場合だけUPDATEする
-	ret, err := s.userRepo.Select(userID, eventID)
-	if err != nil {
-		if err != sql.ErrNoRows {
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		event, err := s.eventRepo.SelectByEventID(ctx, *eventID)
+		if err != nil {
 			return err
 		}
-	}
+		switch event.Status {
+		case domain.EVENT_STABDBY:
+			return domain.ErrEventNotOpen
+		case domain.EVENT_CLOSED:
+			return domain.ErrEventClosed
+		}
 
-	return s.userRepo.WithTransaction(ctx, func(tx *sql.Tx) error {
-		if len(ret.ID) > 0 {
-			return s.userRepo.Update(user, tx)
+		current, err := s.userRepo.SelectByIDAndStatus(ctx, userID, true)
+		if err == nil {
+			if current.EventID == *eventID {
+				return domain.ErrAlreadyParticipated
+			}
+			return domain.ErrAlreadyParticipating
+		} else if err != sql.ErrNoRows {
+			return err
 		}
-		return s.userRepo.Participate(user, tx)
+		return s.userRepo.Participate(ctx, user)
 	})
 }
 
-func (s *CallbackService) GetEventByEventID(eventID domain.EventID) (*domain.Event, error) {
-	log.Println("called application.GetEventByEventID")
-	return s.eventRepo.SelectByEventID(eventID)
+func (s *CallbackService) GetEventByEventID(ctx context.Context, eventID domain.EventID) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called application.GetEventByEventID")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetEventByEventID")
+	defer span.End()
+	return s.eventRepo.SelectByEventID(ctx, eventID)
+}
+
+func (s *CallbackService) GetEventByJoinCode(ctx context.Context, code string) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called application.GetEventByJoinCode")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetEventByJoinCode")
+	defer span.End()
+	return s.eventRepo.SelectByJoinCode(ctx, code)
+}
+
+// VerifyPasscode は非公開イベントのパスコードを照合します
+// 失敗回数が上限に達している場合は照合せずに domain.ErrTooManyPasscodeFailures を返します
+func (s *CallbackService) VerifyPasscode(ctx context.Context, userID *domain.UserID, event *domain.Event, passcode string) (bool, error) {
+	logger.FromContext(ctx).Debug("called application.VerifyPasscode")
+	ctx, span := tracing.Start(ctx, "CallbackService.VerifyPasscode")
+	defer span.End()
+	now := int(time.Now().Unix())
+	count, err := s.eventRepo.CountPasscodeFailures(ctx, event.ID, *userID, now-domain.PasscodeFailureWindow)
+	if err != nil {
+		return false, err
+	}
+	if count >= domain.PasscodeFailureLimit {
+		return false, domain.ErrTooManyPasscodeFailures
+	}
+	if subtle.ConstantTimeCompare([]byte(event.Passcode), []byte(passcode)) == 1 {
+		return true, nil
+	}
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		return s.eventRepo.CreatePasscodeFailure(ctx, event.ID, *userID, now)
+	})
+	return false, err
 }
 
 func (s *CallbackService) LeaveEvent(ctx context.Context, userID *domain.UserID, eventID *domain.EventID) error {
-	log.Println("called application.LeaveEvent")
+	logger.FromContext(ctx).Debug("called application.LeaveEvent")
+	ctx, span := tracing.Start(ctx, "CallbackService.LeaveEvent")
+	defer span.End()
 	now := int(time.Now().Unix())
 	user := &domain.User{
 		ID:             *userID,
@@ -138,13 +312,18 @@ func (s *CallbackService) LeaveEvent(ctx context.Context, userID *domain.UserID,
 		CreatedAt:      now,
 		UpdatedAt:      now,
 	}
-	return s.userRepo.WithTransaction(ctx, func(tx *sql.Tx) error {
-		return s.userRepo.Update(user, tx)
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		return s.userRepo.Update(ctx, user)
 	})
 }
 
 func (s *CallbackService) VoteEvent(ctx context.Context, userID *domain.UserID, eventID *domain.EventID, vote domain.VOTE_STATUS) error {
-	log.Println("called application.VoteEvent")
+	logger.FromContext(ctx).Debug("called application.VoteEvent")
+	ctx, span := tracing.Start(ctx, "CallbackService.VoteEvent")
+	defer span.End()
+	if !vote.IsValid() {
+		return domain.ErrInvalidVote
+	}
 	now := int(time.Now().Unix())
 	user := &domain.User{
 		ID:        *userID,
@@ -153,7 +332,264 @@ func (s *CallbackService) VoteEvent(ctx context.Context, userID *domain.UserID,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
-	return s.userRepo.WithTransaction(ctx, func(tx *sql.Tx) error {
-		return s.userRepo.Vote(user, tx)
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		// 受付の締め切りと同時の投票を取りこぼさないようトランザクション内でマスターから確認する
+		event, err := s.eventRepo.SelectByEventID(ctx, *eventID)
+		if err != nil {
+			return err
+		}
+		if !event.IsVoteOpen(now) {
+			return domain.ErrVotingClosed
+		}
+		current, err := s.userRepo.SelectVote(ctx, userID, eventID)
+		if err != nil {
+			return err
+		}
+		if current.Vote == vote {
+			return nil
+		}
+		if !event.CanChangeVote(current) {
+			return domain.ErrVoteLocked
+		}
+		if err := s.userRepo.Vote(ctx, user); err != nil {
+			return err
+		}
+		// 途中での心変わりも分析できるよう、変更の度に履歴を残す
+		return s.userRepo.CreateVoteHistory(ctx, &domain.VoteHistory{
+			EventID:      *eventID,
+			UserID:       *userID,
+			Vote:         vote,
+			PreviousVote: current.Vote,
+			CreatedAt:    now,
+		})
+	})
+}
+
+// OpenVoting は主催中のイベントの投票の受付を開始します
+// duration が 0 の場合は CloseVoting を呼ぶまで受け付けます
+func (s *CallbackService) OpenVoting(ctx context.Context, ownerID domain.OwnerID, duration time.Duration) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called application.OpenVoting")
+	ctx, span := tracing.Start(ctx, "CallbackService.OpenVoting")
+	defer span.End()
+	status := domain.EVENT_OPEN
+	event, err := s.eventRepo.SelectByOrganizerID(ctx, ownerID, &status)
+	if err != nil {
+		return nil, err
+	}
+	now := int(time.Now().Unix())
+	// 受付中に締め切りだけを変更する場合は受付時間を引き継ぐ
+	if !event.IsVoteOpen(now) {
+		event.VoteOpenedAt = now
+	}
+	event.UpdatedAt = now
+	event.IsVoting = true
+	event.VoteClosesAt = 0
+	if duration > 0 {
+		event.VoteClosesAt = now + int(duration/time.Second)
+	}
+
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		return s.eventRepo.Update(ctx, event)
+	})
+	return event, err
+}
+
+// CloseVoting は主催中のイベントの投票の受付を締め切ります
+func (s *CallbackService) CloseVoting(ctx context.Context, ownerID domain.OwnerID) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called application.CloseVoting")
+	ctx, span := tracing.Start(ctx, "CallbackService.CloseVoting")
+	defer span.End()
+	status := domain.EVENT_OPEN
+	event, err := s.eventRepo.SelectByOrganizerID(ctx, ownerID, &status)
+	if err != nil {
+		return nil, err
+	}
+	event.UpdatedAt = int(time.Now().Unix())
+	event.IsVoting = false
+	event.VoteClosesAt = 0
+
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		return s.eventRepo.Update(ctx, event)
+	})
+	return event, err
+}
+
+// SetVotePolicy は主催中のイベントの投票の変更可否の方針を変更します
+func (s *CallbackService) SetVotePolicy(ctx context.Context, ownerID domain.OwnerID, policy domain.VotePolicy) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called application.SetVotePolicy")
+	ctx, span := tracing.Start(ctx, "CallbackService.SetVotePolicy")
+	defer span.End()
+	status := domain.EVENT_OPEN
+	event, err := s.eventRepo.SelectByOrganizerID(ctx, ownerID, &status)
+	if err != nil {
+		return nil, err
+	}
+	event.UpdatedAt = int(time.Now().Unix())
+	event.VotePolicy = policy
+
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		return s.eventRepo.Update(ctx, event)
+	})
+	return event, err
+}
+
+// PostComment は参加中のイベントにコメントを残します。終了したイベントには残せません
+func (s *CallbackService) PostComment(ctx context.Context, userID *domain.UserID, eventID *domain.EventID, text string) error {
+	logger.FromContext(ctx).Debug("called application.PostComment")
+	ctx, span := tracing.Start(ctx, "CallbackService.PostComment")
+	defer span.End()
+	if utf8.RuneCountInString(text) > domain.CommentMaxLength {
+		return domain.ErrCommentTooLong
+	}
+	comment := &domain.Comment{
+		EventID:   *eventID,
+		UserID:    *userID,
+		Text:      text,
+		CreatedAt: int(time.Now().Unix()),
+	}
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		event, err := s.eventRepo.SelectByEventID(ctx, *eventID)
+		if err != nil {
+			return err
+		}
+		if event.Status == domain.EVENT_CLOSED {
+			return domain.ErrEventClosed
+		}
+		return s.commentRepo.Create(ctx, comment)
+	})
+}
+
+// GetParticipantIDs はイベントに参加中のユーザーのIDを返します
+func (s *CallbackService) GetParticipantIDs(ctx context.Context, eventID domain.EventID) ([]domain.UserID, error) {
+	logger.FromContext(ctx).Debug("called application.GetParticipantIDs")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetParticipantIDs")
+	defer span.End()
+	return s.userRepo.SelectParticipantIDs(ctx, eventID)
+}
+
+func (s *CallbackService) GetOrganizer(ctx context.Context, eventID domain.EventID, ownerID domain.OwnerID) (*domain.Organizer, error) {
+	logger.FromContext(ctx).Debug("called application.GetOrganizer")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetOrganizer")
+	defer span.End()
+	return s.organizerRepo.Select(ctx, eventID, ownerID)
+}
+
+func (s *CallbackService) GetOrganizers(ctx context.Context, eventID domain.EventID) ([]domain.Organizer, error) {
+	logger.FromContext(ctx).Debug("called application.GetOrganizers")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetOrganizers")
+	defer span.End()
+	return s.organizerRepo.SelectList(ctx, eventID)
+}
+
+// IssueInvitation はイベントの招待コードを返します。発行済みの場合は同じコードを使い回します
+func (s *CallbackService) IssueInvitation(ctx context.Context, eventID domain.EventID, ownerID domain.OwnerID) (*domain.Invitation, error) {
+	logger.FromContext(ctx).Debug("called application.IssueInvitation")
+	ctx, span := tracing.Start(ctx, "CallbackService.IssueInvitation")
+	defer span.End()
+	invitation, err := s.organizerRepo.SelectInvitationByEventID(ctx, eventID)
+	if err == nil {
+		return invitation, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+	now := int(time.Now().Unix())
+	invitation = &domain.Invitation{
+		Code:      code,
+		EventID:   eventID,
+		OwnerID:   ownerID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = s.tx.Do(ctx, func(ctx context.Context) error {
+		return s.organizerRepo.CreateInvitation(ctx, invitation)
+	})
+	return invitation, err
+}
+
+func (s *CallbackService) GetInvitation(ctx context.Context, code string) (*domain.Invitation, error) {
+	logger.FromContext(ctx).Debug("called application.GetInvitation")
+	ctx, span := tracing.Start(ctx, "CallbackService.GetInvitation")
+	defer span.End()
+	return s.organizerRepo.SelectInvitation(ctx, code)
+}
+
+func (s *CallbackService) AddOrganizer(ctx context.Context, eventID domain.EventID, ownerID domain.OwnerID) error {
+	logger.FromContext(ctx).Debug("called application.AddOrganizer")
+	ctx, span := tracing.Start(ctx, "CallbackService.AddOrganizer")
+	defer span.End()
+	now := int(time.Now().Unix())
+	organizer := &domain.Organizer{
+		EventID:   eventID,
+		OwnerID:   ownerID,
+		Role:      domain.ORGANIZER_CO,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		return s.organizerRepo.Create(ctx, organizer)
+	})
+}
+
+// RevokeOrganizer は共同主催者を外します
+// 外したユーザーが同じ招待コードで戻れないよう、招待コードも無効にして次回は新しいコードを発行する
+func (s *CallbackService) RevokeOrganizer(ctx context.Context, eventID domain.EventID, ownerID domain.OwnerID) error {
+	logger.FromContext(ctx).Debug("called application.RevokeOrganizer")
+	ctx, span := tracing.Start(ctx, "CallbackService.RevokeOrganizer")
+	defer span.End()
+	organizer := &domain.Organizer{
+		EventID: eventID,
+		OwnerID: ownerID,
+	}
+	return s.tx.Do(ctx, func(ctx context.Context) error {
+		if err := s.organizerRepo.Delete(ctx, organizer); err != nil {
+			return err
+		}
+		return s.organizerRepo.DeleteInvitation(ctx, eventID)
 	})
 }
+
+func newInviteCode() (string, error) {
+	buf := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = inviteCodeLetters[int(b)%len(inviteCodeLetters)]
+	}
+	return string(buf), nil
+}
+
+// newJoinCode は終了していないイベントと重複しない参加コードを生成します
+func (s *CallbackService) newJoinCode(ctx context.Context) (string, error) {
+	for i := 0; i < joinCodeRetry; i++ {
+		code, err := newDigits(domain.JoinCodeLength)
+		if err != nil {
+			return "", err
+		}
+		_, err = s.eventRepo.SelectByJoinCode(ctx, code)
+		if err == sql.ErrNoRows {
+			return code, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return "", errors.New("failed to generate unique join code")
+}
+
+// newDigits は指定桁数のランダムな数字列を生成します
+func newDigits(length int) (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < length; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", length, n), nil
+}
@@ -0,0 +1,208 @@
+package application_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/mochisuna/linebot-sample/application"
+	"github.com/mochisuna/linebot-sample/config"
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/domain/service"
+	"github.com/mochisuna/linebot-sample/infrastructure"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/infrastructure/migration"
+)
+
+// newCallbackService はマイグレーション済みのSQLiteを使うサービスを返します
+func newCallbackService(t *testing.T) service.CallbackService {
+	t.Helper()
+	client, err := db.New(&config.DB{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	migrator, err := migration.New(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return application.NewCallbackService(
+		infrastructure.NewTxManager(client),
+		infrastructure.NewEventRepository(client, client),
+		infrastructure.NewOwnerRepository(client, client),
+		infrastructure.NewUserRepository(client, client),
+		infrastructure.NewOrganizerRepository(client, client),
+		infrastructure.NewCommentRepository(client, client),
+	)
+}
+
+// startEvent は owner が主催するイベントを開催します
+func startEvent(t *testing.T, s service.CallbackService, owner domain.OwnerID) *domain.Event {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.Follow(ctx, owner, string(owner)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RegisterEvent(ctx, owner, "test"); err != nil {
+		t.Fatal(err)
+	}
+	event, err := s.StartEvent(ctx, owner, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// fakeOrganizerRepository は主催者と招待コードをメモリ上に保持します
+type fakeOrganizerRepository struct {
+	repository.OrganizerRepository
+	organizers  map[domain.OwnerID]domain.Organizer
+	invitations map[string]domain.Invitation
+}
+
+func newFakeOrganizerRepository() *fakeOrganizerRepository {
+	return &fakeOrganizerRepository{
+		organizers:  map[domain.OwnerID]domain.Organizer{},
+		invitations: map[string]domain.Invitation{},
+	}
+}
+
+// fakeTxManager はトランザクションを張らずにそのまま実行します
+type fakeTxManager struct{}
+
+func (fakeTxManager) Do(ctx context.Context, fn func(context.Context) error) error {
+	return fn(ctx)
+}
+
+func (r *fakeOrganizerRepository) Select(ctx context.Context, eventID domain.EventID, ownerID domain.OwnerID) (*domain.Organizer, error) {
+	organizer, ok := r.organizers[ownerID]
+	if !ok || organizer.EventID != eventID {
+		return nil, sql.ErrNoRows
+	}
+	return &organizer, nil
+}
+
+func (r *fakeOrganizerRepository) SelectInvitation(ctx context.Context, code string) (*domain.Invitation, error) {
+	invitation, ok := r.invitations[code]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &invitation, nil
+}
+
+func (r *fakeOrganizerRepository) SelectInvitationByEventID(ctx context.Context, eventID domain.EventID) (*domain.Invitation, error) {
+	for _, invitation := range r.invitations {
+		if invitation.EventID == eventID {
+			return &invitation, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeOrganizerRepository) Create(ctx context.Context, organizer *domain.Organizer) error {
+	r.organizers[organizer.OwnerID] = *organizer
+	return nil
+}
+
+func (r *fakeOrganizerRepository) Delete(ctx context.Context, organizer *domain.Organizer) error {
+	delete(r.organizers, organizer.OwnerID)
+	return nil
+}
+
+func (r *fakeOrganizerRepository) CreateInvitation(ctx context.Context, invitation *domain.Invitation) error {
+	r.invitations[invitation.Code] = *invitation
+	return nil
+}
+
+func (r *fakeOrganizerRepository) DeleteInvitation(ctx context.Context, eventID domain.EventID) error {
+	for code, invitation := range r.invitations {
+		if invitation.EventID == eventID {
+			delete(r.invitations, code)
+		}
+	}
+	return nil
+}
+
+func TestRevokeOrganizerInvalidatesInvitation(t *testing.T) {
+	ctx := context.Background()
+	s := application.NewCallbackService(fakeTxManager{}, nil, nil, nil, newFakeOrganizerRepository(), nil)
+	eventID := domain.EventID("e1")
+	co := domain.OwnerID("Uco")
+
+	invitation, err := s.IssueInvitation(ctx, eventID, "Uowner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddOrganizer(ctx, eventID, co); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeOrganizer(ctx, eventID, co); err != nil {
+		t.Fatal(err)
+	}
+
+	// 外されたユーザーが手元の招待コードで戻れない
+	if _, err := s.GetInvitation(ctx, invitation.Code); err != sql.ErrNoRows {
+		t.Fatalf("GetInvitation(revoked code) error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.GetOrganizer(ctx, eventID, co); err != sql.ErrNoRows {
+		t.Fatalf("GetOrganizer(revoked) error = %v, want sql.ErrNoRows", err)
+	}
+
+	// 次の招待では新しいコードを発行する
+	next, err := s.IssueInvitation(ctx, eventID, "Uowner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Code == invitation.Code {
+		t.Fatalf("IssueInvitation after revoke reused code %v", next.Code)
+	}
+	if got, err := s.GetInvitation(ctx, next.Code); err != nil || got.EventID != eventID {
+		t.Fatalf("GetInvitation(new code) = %+v, %v", got, err)
+	}
+}
+
+func TestVoteEventRejectsInvalidVote(t *testing.T) {
+	ctx := context.Background()
+	s := newCallbackService(t)
+	event := startEvent(t, s, "Uowner")
+	if _, err := s.OpenVoting(ctx, "Uowner", 0); err != nil {
+		t.Fatal(err)
+	}
+	userID := domain.UserID("Uuser")
+	if err := s.ParticipateEvent(ctx, &userID, &event.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		vote domain.VOTE_STATUS
+		want error
+	}{
+		{domain.NOT_VOTED, domain.ErrInvalidVote},
+		{domain.BAD + 1, domain.ErrInvalidVote},
+		{-1, domain.ErrInvalidVote},
+		{domain.GOOD, nil},
+	}
+	for _, tt := range tests {
+		if err := s.VoteEvent(ctx, &userID, &event.ID, tt.vote); err != tt.want {
+			t.Errorf("VoteEvent(%d) error = %v, want %v", tt.vote, err, tt.want)
+		}
+	}
+}
+
+func TestStartEventRecordsOpenedAt(t *testing.T) {
+	ctx := context.Background()
+	s := newCallbackService(t)
+	event := startEvent(t, s, "Uowner")
+	got, err := s.GetEventByEventID(ctx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.OpenedAt == 0 || got.OpenedAt < got.CreatedAt {
+		t.Errorf("OpenedAt = %v, CreatedAt = %v, want the start time", got.OpenedAt, got.CreatedAt)
+	}
+}
@@ -0,0 +1,51 @@
+package application
+
+import (
+	"context"
+
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/domain/service"
+	"github.com/mochisuna/linebot-sample/logger"
+	"github.com/mochisuna/linebot-sample/tracing"
+)
+
+type ReportService struct {
+	eventRepo        repository.EventRepository
+	commentRepo      repository.CommentRepository
+	analyticsService service.AnalyticsService
+}
+
+// NewReportService inject eventRepo, commentRepo, analyticsService
+func NewReportService(eventRepo repository.EventRepository, commentRepo repository.CommentRepository, analyticsService service.AnalyticsService) service.ReportService {
+	return &ReportService{
+		eventRepo:        eventRepo,
+		commentRepo:      commentRepo,
+		analyticsService: analyticsService,
+	}
+}
+
+// GetReport はイベントの集計とコメントをまとめたレポートを返します
+func (s *ReportService) GetReport(ctx context.Context, eventID domain.EventID) (*domain.Report, error) {
+	logger.FromContext(ctx).Debug("called application.GetReport")
+	ctx, span := tracing.Start(ctx, "ReportService.GetReport")
+	defer span.End()
+	event, err := s.eventRepo.SelectByEventID(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	// 区間は既定値に任せ、長いイベントは集計側で広げる
+	analytics, err := s.analyticsService.GetEventAnalytics(ctx, eventID, 0)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := s.commentRepo.SelectByEventID(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Report{
+		Event:     event,
+		Analytics: analytics,
+		Comments:  comments,
+	}, nil
+}
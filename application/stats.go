@@ -0,0 +1,43 @@
+package application
+
+import (
+	"context"
+
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/domain/service"
+	"github.com/mochisuna/linebot-sample/logger"
+	"github.com/mochisuna/linebot-sample/tracing"
+)
+
+type StatsService struct {
+	eventRepo repository.EventRepository
+	userRepo  repository.UserRepository
+}
+
+// NewStatsService inject eventRepo, userRepo
+func NewStatsService(eventRepo repository.EventRepository, userRepo repository.UserRepository) service.StatsService {
+	return &StatsService{
+		eventRepo: eventRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// GetStats は開催中のイベント数と参加中のユーザー数を返します
+func (s *StatsService) GetStats(ctx context.Context) (*domain.Stats, error) {
+	logger.FromContext(ctx).Debug("called application.GetStats")
+	ctx, span := tracing.Start(ctx, "StatsService.GetStats")
+	defer span.End()
+	openEvents, err := s.eventRepo.CountByStatus(ctx, domain.EVENT_OPEN)
+	if err != nil {
+		return nil, err
+	}
+	participants, err := s.userRepo.CountParticipants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Stats{
+		OpenEvents:         openEvents,
+		ActiveParticipants: participants,
+	}, nil
+}
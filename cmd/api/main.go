@@ -1,62 +1,227 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/mochisuna/linebot-sample/application"
 	"github.com/mochisuna/linebot-sample/config"
 	"github.com/mochisuna/linebot-sample/handler"
+	"github.com/mochisuna/linebot-sample/handler/flex"
 	"github.com/mochisuna/linebot-sample/infrastructure"
+	"github.com/mochisuna/linebot-sample/infrastructure/cache"
 	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/infrastructure/migration"
+	"github.com/mochisuna/linebot-sample/infrastructure/ratelimit"
+	"github.com/mochisuna/linebot-sample/logger"
+	"github.com/mochisuna/linebot-sample/metrics"
+	"github.com/mochisuna/linebot-sample/tracing"
 )
 
+// 終了時に処理中のリクエストを待つ時間の既定値
+const defaultShutdownTimeout = 30 * time.Second
+
 func main() {
 	// parse options
-	path := flag.String("c", "_tools/local/config.toml", "config file")
+	path := flag.String("c", "_tools/local/config.toml", "config file (空の場合は環境変数のみで設定する)")
+	checkConfig := flag.Bool("check-config", false, "print the effective config with secrets redacted and exit")
+	render := flag.String("render", "", "print the flex message rendered from the named template and exit")
+	renderData := flag.String("data", "", "JSON file of the data for -render (空の場合はサンプルのデータを使う)")
 	flag.Parse()
 
 	// import config
 	conf := &config.Config{}
-	log.Println(*path)
 	if err := config.New(conf, *path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *checkConfig {
+		if err := conf.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := conf.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *render != "" {
+		if err := renderFlex(conf.Flex.TemplateDir, *render, *renderData); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := conf.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// 標準の log パッケージの出力も含めて構造化ログにする
+	slog.SetDefault(logger.New(&conf.Log))
+	slog.Info("loaded config", "path", *path)
+
+	// init tracing
+	shutdownTracing, err := tracing.New(context.Background(), &conf.Trace)
+	if err != nil {
 		panic(err)
 	}
+	defer func() {
+		// 未送信のスパンを送り切る
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to flush traces", "error", err)
+		}
+	}()
 
 	// init db connection
 	// master db
-	dbmClient, err := db.NewMySQL(&conf.DBMaster)
+	dbmClient, err := db.New(&conf.DBMaster)
 	if err != nil {
 		panic(err)
 	}
 	defer dbmClient.Close()
+	dbmClient.TrackWrites(time.Duration(conf.Replica.StickySeconds) * time.Second)
+	if conf.DBMaster.AutoMigrate {
+		migrator, err := migration.New(dbmClient)
+		if err != nil {
+			panic(err)
+		}
+		if err := migrator.Up(context.Background()); err != nil {
+			panic(err)
+		}
+	}
 	// slave db
-	dbsClient, err := db.NewMySQL(&conf.DBSlave)
-	if err != nil {
-		panic(err)
+	// レプリカを使わない構成やSQLiteではマスターをそのまま読み込みにも使う
+	dbsClient := dbmClient
+	if !conf.Replica.Disabled && dbmClient.Driver != db.DriverSQLite {
+		dbsClient, err = db.New(&conf.DBSlave)
+		if err != nil {
+			panic(err)
+		}
+		defer dbsClient.Close()
+		dbsClient.SetPrimary(dbmClient)
 	}
-	defer dbsClient.Close()
 
 	// initialize and injection relay
 	// init repository
-	eventRepo := infrastructure.NewEventRepository(dbmClient, dbsClient)
-	ownerRepo := infrastructure.NewOwnerRepository(dbmClient, dbsClient)
-	userRepo := infrastructure.NewUserRepository(dbmClient, dbsClient)
+	txManager := infrastructure.NewTxManager(dbmClient)
+	eventRepo := infrastructure.InstrumentEventRepository(infrastructure.NewEventRepository(dbmClient, dbsClient))
+	ownerRepo := infrastructure.InstrumentOwnerRepository(infrastructure.NewOwnerRepository(dbmClient, dbsClient))
+	userRepo := infrastructure.InstrumentUserRepository(infrastructure.NewUserRepository(dbmClient, dbsClient))
+	organizerRepo := infrastructure.InstrumentOrganizerRepository(infrastructure.NewOrganizerRepository(dbmClient, dbsClient))
+	commentRepo := infrastructure.InstrumentCommentRepository(infrastructure.NewCommentRepository(dbmClient, dbsClient))
+	// init cache
+	repoCache, err := cache.New(&conf.Cache)
+	if err != nil {
+		panic(err)
+	}
+	if closer, ok := repoCache.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if repoCache != nil {
+		ttl := time.Duration(conf.Cache.TTLSeconds) * time.Second
+		eventRepo = infrastructure.NewCachedEventRepository(eventRepo, repoCache, ttl)
+		userRepo = infrastructure.NewCachedUserRepository(userRepo, repoCache, ttl)
+		organizerRepo = infrastructure.NewCachedOrganizerRepository(organizerRepo, repoCache, ttl)
+	}
 	// init application service
-	callbackService := application.NewCallbackService(eventRepo, ownerRepo, userRepo)
+	callbackService := application.NewCallbackService(txManager, eventRepo, ownerRepo, userRepo, organizerRepo, commentRepo)
+	statsService := application.NewStatsService(eventRepo, userRepo)
+	analyticsService := application.NewAnalyticsService(eventRepo, userRepo)
+	reportService := application.NewReportService(eventRepo, commentRepo, analyticsService)
 
 	// inject all services
 	services := &handler.Services{
-		CallbackService: callbackService,
+		CallbackService:  callbackService,
+		StatsService:     statsService,
+		AnalyticsService: analyticsService,
+		ReportService:    reportService,
+	}
+	metrics.Registry.MustRegister(handler.NewStatsCollector(statsService))
+
+	// テンプレートの誤りは返信時ではなく起動時に気付けるようにする
+	templates, err := flex.Load(conf.Flex.TemplateDir)
+	if err != nil {
+		panic(err)
 	}
+	if err := handler.ValidateFlex(templates); err != nil {
+		panic(err)
+	}
+	bot := handler.NewLineBot(&conf.Line, templates)
 
-	bot := handler.NewLineBot(&conf.Line)
+	// init rate limiter
+	var limiter handler.RateLimiter
+	rateLimiter, err := ratelimit.New(&conf.RateLimit, &conf.Cache)
+	if err != nil {
+		panic(err)
+	}
+	if rateLimiter != nil {
+		defer rateLimiter.Close()
+		limiter = rateLimiter
+	}
 
 	// Run Api server
-	server := handler.New(conf.Server.Port, services, bot)
-	log.Println("Start server")
-	if err := server.ListenAndServe(); err != nil {
+	databases := map[string]handler.DBChecker{
+		"master": dbmClient,
+	}
+	if dbsClient != dbmClient {
+		databases["replica"] = dbsClient
+	}
+	server := handler.New(&conf.Server, &conf.Report, services, bot, databases, limiter)
+	slog.Info("start server", "addr", conf.Server.Port)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	// SIGTERM/SIGINT を受けたら処理中のwebhookを捌き切ってから終了する
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-errCh:
 		panic(fmt.Sprintf("Failed ListenAndServe. err: %v", err))
+	case s := <-sig:
+		slog.Info("shutting down", "signal", s.String())
+	}
+
+	timeout := defaultShutdownTimeout
+	if conf.Server.ShutdownTimeoutSeconds > 0 {
+		timeout = time.Duration(conf.Server.ShutdownTimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("failed graceful shutdown", "error", err)
+	}
+	// DBのコネクションは defer で閉じる
+	slog.Info("stop server")
+}
+
+// renderFlex はテンプレートを展開したメッセージを標準出力に書き出します
+func renderFlex(dir, name, dataPath string) error {
+	templates, err := flex.Load(dir)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if dataPath != "" {
+		if data, err = os.ReadFile(dataPath); err != nil {
+			return err
+		}
+	}
+	body, err := handler.RenderFlex(templates, name, data)
+	if err != nil {
+		return err
 	}
+	_, err = fmt.Println(string(body))
+	return err
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/config"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/infrastructure/migration"
+)
+
+const usage = `usage: migrate [-c config] <command>
+
+commands:
+  status     show applied and pending migrations
+  up         apply all pending migrations
+  down [n]   roll back the latest n migrations (default 1)
+  drift      compare the live schema with the one built from migrations`
+
+func main() {
+	// parse options
+	path := flag.String("c", "_tools/local/config.toml", "config file")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// import config
+	conf := &config.Config{}
+	if err := config.New(conf, *path); err != nil {
+		log.Fatal(err)
+	}
+
+	// マイグレーションは常にマスターに対して行う
+	client, err := db.New(&conf.DBMaster)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+	migrator, err := migration.New(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	switch flag.Arg(0) {
+	case "status":
+		err = status(ctx, migrator)
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			if steps, err = strconv.Atoi(flag.Arg(1)); err != nil || steps < 1 {
+				log.Fatalf("invalid steps: %v", flag.Arg(1))
+			}
+		}
+		err = migrator.Down(ctx, steps)
+	case "drift":
+		var drifted bool
+		drifted, err = drift(ctx, client, &conf.DBMaster)
+		if err == nil && drifted {
+			os.Exit(1)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func status(ctx context.Context, migrator *migration.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, st := range statuses {
+		state := "pending"
+		if st.Applied {
+			state = "applied " + time.Unix(int64(st.AppliedAt), 0).Format(time.RFC3339)
+		}
+		if st.Modified {
+			state += " (modified after apply)"
+		}
+		fmt.Printf("%4d %-30s %s\n", st.Version, st.Name, state)
+	}
+	return nil
+}
+
+// drift は全マイグレーションを一時データベースに適用し、稼働中のスキーマと比較します
+func drift(ctx context.Context, client *db.Client, conf *config.DB) (bool, error) {
+	shadowConf := *conf
+	if client.Driver == db.DriverSQLite {
+		// SQLiteはファイル単位のため一時ファイルに作る
+		shadowConf.Path = filepath.Join(os.TempDir(), fmt.Sprintf("linebot_drift_%v.db", time.Now().Unix()))
+		defer func() {
+			for _, suffix := range []string{"", "-wal", "-shm"} {
+				os.Remove(shadowConf.Path + suffix)
+			}
+		}()
+	} else {
+		shadowConf.DBName = fmt.Sprintf("%v_drift_%v", conf.DBName, time.Now().Unix())
+		if _, err := client.DB.ExecContext(ctx, "CREATE DATABASE "+client.QuoteIdent(shadowConf.DBName)); err != nil {
+			return false, err
+		}
+		defer func() {
+			if _, err := client.DB.ExecContext(ctx, "DROP DATABASE "+client.QuoteIdent(shadowConf.DBName)); err != nil {
+				log.Printf("failed to drop %v: %v", shadowConf.DBName, err)
+			}
+		}()
+	}
+
+	shadow, err := db.New(&shadowConf)
+	if err != nil {
+		return false, err
+	}
+	defer shadow.Close()
+	shadowMigrator, err := migration.New(shadow)
+	if err != nil {
+		return false, err
+	}
+	if err := shadowMigrator.Up(ctx); err != nil {
+		return false, err
+	}
+
+	expected, err := migration.Schema(ctx, shadow, shadowConf.DBName)
+	if err != nil {
+		return false, err
+	}
+	actual, err := migration.Schema(ctx, client, conf.DBName)
+	if err != nil {
+		return false, err
+	}
+	diff := migration.Diff(expected, actual)
+	if len(diff) < 1 {
+		fmt.Println("no drift")
+		return false, nil
+	}
+	for _, line := range diff {
+		fmt.Println(line)
+	}
+	return true, nil
+}
@@ -1,40 +1,127 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/BurntSushi/toml"
 )
 
 // Config all settings
 type Config struct {
-	Server   Server `toml:"server"`
-	DBMaster DB     `toml:"dbm"`
-	DBSlave  DB     `toml:"dbs"`
-	Line     Line   `toml:"line"`
+	Server    Server    `toml:"server"`
+	DBMaster  DB        `toml:"dbm"`
+	DBSlave   DB        `toml:"dbs"`
+	Replica   Replica   `toml:"replica"`
+	Line      Line      `toml:"line"`
+	Log       Log       `toml:"log"`
+	Trace     Trace     `toml:"trace"`
+	Cache     Cache     `toml:"cache"`
+	RateLimit RateLimit `toml:"rate_limit"`
+	Report    Report    `toml:"report"`
+	Flex      Flex      `toml:"flex"`
 }
 
 // Server port
 type Server struct {
-	Port string `toml:"port"`
+	Port                   string `toml:"port"`
+	BaseURL                string `toml:"base_url"`                  // LINEから参照できる外部公開URL (例: https://example.com)
+	ShutdownTimeoutSeconds int    `toml:"shutdown_timeout_seconds"`  // 終了時に処理中のリクエストを待つ秒数
+	AdminToken             string `toml:"admin_token" secret:"true"` // 管理APIのBearerトークン。空の場合は管理APIを無効にする
 }
 
 // Line
 type Line struct {
-	ChannelSecret string `toml:"channel_secret"`
-	ChannelToken  string `toml:"channel_token"`
+	ChannelSecret string `toml:"channel_secret" secret:"true"`
+	ChannelToken  string `toml:"channel_token" secret:"true"`
+	BasicID       string `toml:"basic_id"` // @から始まるbotのベーシックID
+}
+
+// Replica レプリカ読み込みの整合性設定
+type Replica struct {
+	Disabled      bool `toml:"disabled"`       // trueの場合はDBSlaveを使わずマスターのみで動作する
+	StickySeconds int  `toml:"sticky_seconds"` // 書き込み後にそのユーザーの読み込みをマスターへ向ける秒数
+}
+
+// Log ログ出力の設定
+type Log struct {
+	Level     string `toml:"level"`                   // debug, info, warn, error
+	RedactPII bool   `toml:"redact_pii"`              // 表示名やメッセージ本文を伏せ、ユーザーIDをハッシュにする
+	HashSalt  string `toml:"hash_salt" secret:"true"` // ユーザーIDのハッシュに使うソルト
+}
+
+// Trace トレースの送信設定
+type Trace struct {
+	Exporter    string  `toml:"exporter"`     // none, stdout, otlp。空の場合は none
+	Endpoint    string  `toml:"endpoint"`     // otlp の送信先 (例: localhost:4318)
+	Insecure    bool    `toml:"insecure"`     // otlp をTLSなしで送信する
+	ServiceName string  `toml:"service_name"` // 空の場合は linebot-sample
+	SampleRatio float64 `toml:"sample_ratio"` // 0の場合は全て記録する
+}
+
+// Cache よく参照されるデータのキャッシュ設定
+type Cache struct {
+	Backend       string `toml:"backend"`     // none, memory, redis。空の場合は none
+	Size          int    `toml:"size"`        // memory の最大件数
+	TTLSeconds    int    `toml:"ttl_seconds"` // 保持する秒数。他のプロセスやレプリカ遅延による古い値はこの秒数で解消される
+	RedisAddr     string `toml:"redis_addr"`  // 例: localhost:6379
+	RedisPassword string `toml:"redis_password" secret:"true"`
+	RedisDB       int    `toml:"redis_db"`
+}
+
+// RateLimit ユーザーごとのコマンドの実行回数の制限
+// トークンバケットで、burst 回まで続けて実行でき、その後は1秒に rate 回まで回復する
+type RateLimit struct {
+	Backend string  `toml:"backend"` // none, memory, redis。空の場合は memory。redis は [cache] の接続先を使う
+	Rate    float64 `toml:"rate"`    // 1秒あたりに回復する回数。0の場合は1
+	Burst   int     `toml:"burst"`   // 続けて実行できる回数。0の場合は5
+	// コマンドごとの上書き (例: [rate_limit.commands.voted])
+	// 環境変数では LINEBOT_RATE_LIMIT_COMMANDS="voted=0.2:3,list=0.5:3" のように全体を置き換える
+	Commands map[string]RateLimitRule `toml:"commands"`
+}
+
+// RateLimitRule コマンドごとの制限
+type RateLimitRule struct {
+	Rate  float64 `toml:"rate"`
+	Burst int     `toml:"burst"`
+}
+
+// Report イベント終了時に主催者へ渡すレポートの設定
+type Report struct {
+	Secret   string `toml:"secret" secret:"true"` // レポートURLの署名に使う鍵。空の場合はレポートのURLを発行しない
+	TTLHours int    `toml:"ttl_hours"`            // レポートURLの有効時間。0の場合は72時間
+}
+
+// Flex botの返信に使う Flex Message のテンプレートの設定
+type Flex struct {
+	TemplateDir string `toml:"template_dir"` // テンプレート (*.json) を置くディレクトリ。空の場合は _tools/flex
 }
 
 // DB database structure
 type DB struct {
+	Driver   string `toml:"driver"` // mysql, postgres, sqlite。空の場合は mysql
+	Path     string `toml:"path"`   // sqlite のデータベースファイル
 	Host     string `toml:"host"`
 	Port     string `toml:"port"`
 	User     string `toml:"user"`
-	Password string `toml:"password"`
+	Password string `toml:"password" secret:"true"`
 	DBName   string `toml:"dbname"`
+	// コネクションプール設定。0の場合はdatabase/sqlの既定値
+	MaxOpenConns           int `toml:"max_open_conns"`
+	MaxIdleConns           int `toml:"max_idle_conns"`
+	ConnMaxLifetimeSeconds int `toml:"conn_max_lifetime_seconds"`
+	DialTimeoutSeconds     int `toml:"dial_timeout_seconds"`
+	// 起動時に未適用のマイグレーションを適用する。sqlite で単体で動かす場合に使う
+	AutoMigrate bool `toml:"auto_migrate"`
 }
 
 // New Config
+// 設定ファイルを読み込んだ後、環境変数で上書きします
+// 設定ファイルが指定されていない場合は環境変数のみで設定します
 func New(config *Config, configPath string) error {
-	_, err := toml.DecodeFile(configPath, config)
-	return err
-
+	if configPath != "" {
+		if _, err := toml.DecodeFile(configPath, config); err != nil {
+			return fmt.Errorf("failed to load config file %v: %v", configPath, err)
+		}
+	}
+	return applyEnv(config)
 }
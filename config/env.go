@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// 環境変数名の接頭辞
+// 例: [dbm] password は LINEBOT_DBM_PASSWORD、ファイルから読む場合は LINEBOT_DBM_PASSWORD_FILE
+const EnvPrefix = "LINEBOT_"
+
+const redacted = "[REDACTED]"
+
+// applyEnv は設定の各項目を対応する環境変数で上書きします
+func applyEnv(config *Config) error {
+	return walk(reflect.ValueOf(config).Elem(), nil, func(field reflect.Value, path []string, _ reflect.StructField) error {
+		name := envName(path)
+		value, ok, err := lookupEnv(name)
+		if err != nil || !ok {
+			return err
+		}
+		if err := setValue(field, value); err != nil {
+			return fmt.Errorf("invalid value for %v: %v", name, err)
+		}
+		return nil
+	})
+}
+
+// lookupEnv は環境変数の値を返します
+// NAME_FILE が設定されている場合はそのファイルの内容を値として使います
+func lookupEnv(name string) (string, bool, error) {
+	if file, ok := os.LookupEnv(name + "_FILE"); ok {
+		if _, ok := os.LookupEnv(name); ok {
+			return "", false, fmt.Errorf("both %v and %v_FILE are set", name, name)
+		}
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read %v_FILE: %v", name, err)
+		}
+		return strings.TrimRight(string(body), "\r\n"), true, nil
+	}
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
+
+func envName(path []string) string {
+	return EnvPrefix + strings.ToUpper(strings.Join(path, "_"))
+}
+
+// walk は設定の末端の項目ごとに fn を呼び出します。path は toml のキーの並び
+func walk(v reflect.Value, path []string, fn func(reflect.Value, []string, reflect.StructField) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("toml")
+		if key == "" || key == "-" {
+			continue
+		}
+		fieldPath := append(append([]string{}, path...), key)
+		if field.Type.Kind() == reflect.Struct {
+			if err := walk(v.Field(i), fieldPath, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(v.Field(i), fieldPath, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Map:
+		rules, ok := field.Addr().Interface().(*map[string]RateLimitRule)
+		if !ok {
+			return fmt.Errorf("unsupported type %v", field.Type())
+		}
+		parsed, err := parseRateLimitRules(value)
+		if err != nil {
+			return err
+		}
+		*rules = parsed
+	default:
+		return fmt.Errorf("unsupported type %v", field.Type())
+	}
+	return nil
+}
+
+// parseRateLimitRules は "voted=0.2:3,list=0.5:3" の形式のコマンドごとの制限を読み込みます
+// コマンド名には "vote open" のように空白を含められる
+func parseRateLimitRules(value string) (map[string]RateLimitRule, error) {
+	rules := map[string]RateLimitRule{}
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		command, rule, ok := strings.Cut(entry, "=")
+		command = strings.TrimSpace(command)
+		rate, burst, ok2 := strings.Cut(rule, ":")
+		if !ok || !ok2 || command == "" {
+			return nil, fmt.Errorf("%q must be in the form command=rate:burst", entry)
+		}
+		r, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate for %v: %v", command, err)
+		}
+		b, err := strconv.Atoi(strings.TrimSpace(burst))
+		if err != nil {
+			return nil, fmt.Errorf("invalid burst for %v: %v", command, err)
+		}
+		rules[command] = RateLimitRule{Rate: r, Burst: b}
+	}
+	return rules, nil
+}
+
+// Redacted は秘匿情報を伏せた設定のコピーを返します
+func (c Config) Redacted() Config {
+	walk(reflect.ValueOf(&c).Elem(), nil, func(field reflect.Value, _ []string, sf reflect.StructField) error {
+		if sf.Tag.Get("secret") == "true" && field.String() != "" {
+			field.SetString(redacted)
+		}
+		return nil
+	})
+	return c
+}
+
+// Print は秘匿情報を伏せた設定を toml 形式で出力します
+func (c Config) Print(w io.Writer) error {
+	return toml.NewEncoder(w).Encode(c.Redacted())
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyEnvRateLimitCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]RateLimitRule
+		wantErr bool
+	}{
+		{
+			name:  "commands",
+			value: "voted=0.2:3, vote open = 0.1:2",
+			want:  map[string]RateLimitRule{"voted": {Rate: 0.2, Burst: 3}, "vote open": {Rate: 0.1, Burst: 2}},
+		},
+		{
+			// 空にするとファイルの設定を消す
+			name:  "empty",
+			value: "",
+			want:  map[string]RateLimitRule{},
+		},
+		{name: "missing burst", value: "voted=0.2", wantErr: true},
+		{name: "missing command", value: "=0.2:3", wantErr: true},
+		{name: "invalid rate", value: "voted=fast:3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvPrefix+"RATE_LIMIT_COMMANDS", tt.value)
+			c := &Config{RateLimit: RateLimit{Commands: map[string]RateLimitRule{"list": {Rate: 0.5, Burst: 3}}}}
+			err := applyEnv(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(c.RateLimit.Commands, tt.want) {
+				t.Errorf("Commands = %v, want %v", c.RateLimit.Commands, tt.want)
+			}
+		})
+	}
+}
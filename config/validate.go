@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ValidationError は設定の誤りをまとめたもの
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(key, format string, args ...interface{}) {
+	env := envName(strings.Split(key, "."))
+	// コマンドごとの制限は1つの環境変数にまとめて設定する
+	if strings.HasPrefix(key, "rate_limit.commands.") {
+		env = envName([]string{"rate_limit", "commands"})
+	}
+	v.problems = append(v.problems, fmt.Sprintf("%v (%v): %v", key, env, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) required(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(key, "is required")
+	}
+}
+
+func (v *validator) nonNegative(key string, value int) {
+	if value < 0 {
+		v.add(key, "must not be negative, got %v", value)
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(key, "must be one of %v, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validator) rateLimit(key string, rate float64, burst int) {
+	if rate < 0 {
+		v.add(key+".rate", "must not be negative, got %v", rate)
+	}
+	v.nonNegative(key+".burst", burst)
+}
+
+func (v *validator) port(key, value string) {
+	if value == "" {
+		v.add(key, "is required")
+		return
+	}
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		v.add(key, "must be in the form \":8080\" or \"host:8080\", got %q", value)
+	}
+}
+
+// driverOf は既定値を補ったドライバ名を返します。空の場合は mysql
+func driverOf(db *DB) string {
+	if db.Driver == "" {
+		return "mysql"
+	}
+	return db.Driver
+}
+
+func (v *validator) db(key string, db *DB) {
+	if db.Driver != "" {
+		v.oneOf(key+".driver", db.Driver, "mysql", "postgres", "sqlite")
+	}
+	if db.Driver == "sqlite" {
+		v.required(key+".path", db.Path)
+		return
+	}
+	v.required(key+".host", db.Host)
+	v.port(key+".port", db.Port)
+	v.required(key+".user", db.User)
+	v.required(key+".dbname", db.DBName)
+	v.nonNegative(key+".max_open_conns", db.MaxOpenConns)
+	v.nonNegative(key+".max_idle_conns", db.MaxIdleConns)
+	v.nonNegative(key+".conn_max_lifetime_seconds", db.ConnMaxLifetimeSeconds)
+	v.nonNegative(key+".dial_timeout_seconds", db.DialTimeoutSeconds)
+}
+
+// Validate はAPIサーバーの起動に必要な設定が揃っているかを確認します
+func (c *Config) Validate() error {
+	v := &validator{}
+	v.port("server.port", c.Server.Port)
+	if c.Server.BaseURL != "" && !strings.HasPrefix(c.Server.BaseURL, "https://") && !strings.HasPrefix(c.Server.BaseURL, "http://") {
+		v.add("server.base_url", "must start with https:// or http://, got %q", c.Server.BaseURL)
+	}
+	v.nonNegative("server.shutdown_timeout_seconds", c.Server.ShutdownTimeoutSeconds)
+
+	v.required("line.channel_secret", c.Line.ChannelSecret)
+	v.required("line.channel_token", c.Line.ChannelToken)
+	if c.Line.BasicID != "" && !strings.HasPrefix(c.Line.BasicID, "@") {
+		v.add("line.basic_id", "must start with @, got %q", c.Line.BasicID)
+	}
+
+	v.db("dbm", &c.DBMaster)
+	// sqlite はマスターとレプリカを区別しない
+	if !c.Replica.Disabled && c.DBMaster.Driver != "sqlite" {
+		v.db("dbs", &c.DBSlave)
+		if driverOf(&c.DBSlave) != driverOf(&c.DBMaster) {
+			v.add("dbs.driver", "must be the same as dbm.driver, got %q and %q", driverOf(&c.DBSlave), driverOf(&c.DBMaster))
+		}
+	}
+	v.nonNegative("replica.sticky_seconds", c.Replica.StickySeconds)
+
+	if c.Log.Level != "" {
+		v.oneOf("log.level", strings.ToLower(c.Log.Level), "debug", "info", "warn", "error")
+	}
+	if c.Trace.Exporter != "" {
+		v.oneOf("trace.exporter", c.Trace.Exporter, "none", "stdout", "otlp")
+	}
+	if c.Trace.Exporter == "otlp" {
+		v.required("trace.endpoint", c.Trace.Endpoint)
+	}
+	if c.Trace.SampleRatio < 0 || c.Trace.SampleRatio > 1 {
+		v.add("trace.sample_ratio", "must be between 0 and 1, got %v", c.Trace.SampleRatio)
+	}
+
+	if c.Cache.Backend != "" {
+		v.oneOf("cache.backend", c.Cache.Backend, "none", "memory", "redis")
+	}
+	if c.Cache.Backend == "redis" {
+		v.required("cache.redis_addr", c.Cache.RedisAddr)
+	}
+	v.nonNegative("cache.size", c.Cache.Size)
+	v.nonNegative("cache.ttl_seconds", c.Cache.TTLSeconds)
+
+	if c.RateLimit.Backend != "" {
+		v.oneOf("rate_limit.backend", c.RateLimit.Backend, "none", "memory", "redis")
+	}
+	if c.RateLimit.Backend == "redis" {
+		v.required("cache.redis_addr", c.Cache.RedisAddr)
+	}
+	v.rateLimit("rate_limit", c.RateLimit.Rate, c.RateLimit.Burst)
+	commands := make([]string, 0, len(c.RateLimit.Commands))
+	for command := range c.RateLimit.Commands {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		rule := c.RateLimit.Commands[command]
+		v.rateLimit("rate_limit.commands."+command, rule.Rate, rule.Burst)
+	}
+
+	v.nonNegative("report.ttl_hours", c.Report.TTLHours)
+	if c.Report.Secret != "" {
+		v.required("server.base_url", c.Server.BaseURL)
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
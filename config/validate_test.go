@@ -0,0 +1,93 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+// validConfig は検証を通る最小限の設定を返します
+func validConfig() *Config {
+	db := DB{Host: "localhost", Port: ":3306", User: "user", DBName: "sample"}
+	return &Config{
+		Server:   Server{Port: ":8080"},
+		Line:     Line{ChannelSecret: "secret", ChannelToken: "token"},
+		DBMaster: db,
+		DBSlave:  db,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name: "replica disabled",
+			modify: func(c *Config) {
+				c.Replica.Disabled = true
+				c.DBSlave = DB{}
+			},
+		},
+		{
+			// 空のドライバは mysql として扱う
+			name:   "default driver on one side",
+			modify: func(c *Config) { c.DBMaster.Driver = "mysql" },
+		},
+		{
+			name:   "driver mismatch",
+			modify: func(c *Config) { c.DBSlave.Driver = "postgres" },
+			want:   []string{`dbs.driver (LINEBOT_DBS_DRIVER): must be the same as dbm.driver, got "postgres" and "mysql"`},
+		},
+		{
+			name: "problems",
+			modify: func(c *Config) {
+				c.Line.ChannelSecret = ""
+				c.DBMaster.Port = "3306"
+			},
+			want: []string{
+				"line.channel_secret (LINEBOT_LINE_CHANNEL_SECRET): is required",
+				`dbm.port (LINEBOT_DBM_PORT): must be in the form ":8080" or "host:8080", got "3306"`,
+			},
+		},
+		{
+			name: "rate limit commands in order",
+			modify: func(c *Config) {
+				c.RateLimit.Commands = map[string]RateLimitRule{
+					"voted":       {Rate: -1},
+					"list":        {Burst: -1},
+					"vote open":   {Rate: 1, Burst: 1},
+					"participate": {Rate: -1, Burst: -1},
+				}
+			},
+			want: []string{
+				"rate_limit.commands.list.burst (LINEBOT_RATE_LIMIT_COMMANDS): must not be negative, got -1",
+				"rate_limit.commands.participate.rate (LINEBOT_RATE_LIMIT_COMMANDS): must not be negative, got -1",
+				"rate_limit.commands.participate.burst (LINEBOT_RATE_LIMIT_COMMANDS): must not be negative, got -1",
+				"rate_limit.commands.voted.rate (LINEBOT_RATE_LIMIT_COMMANDS): must not be negative, got -1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(c)
+			err := c.Validate()
+			var got []string
+			if err != nil {
+				verr, ok := err.(*ValidationError)
+				if !ok {
+					t.Fatalf("Validate() error = %v, want *ValidationError", err)
+				}
+				got = verr.Problems
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() problems =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package domain
+
+// Score は平均や推移の計算に使う点数を返します。未投票は 0
+func (v VOTE_STATUS) Score() int {
+	switch v {
+	case GREAT:
+		return 4
+	case GOOD:
+		return 3
+	case NOT_GOOD:
+		return 2
+	case BAD:
+		return 1
+	}
+	return 0
+}
+
+// VoteCount は投票ごとの件数
+type VoteCount struct {
+	Vote  VOTE_STATUS
+	Count int
+}
+
+// TimelineBucket は一定時間ごとの参加状況と投票の推移
+type TimelineBucket struct {
+	Start  int // 区間の開始時刻
+	Joins  int // 区間内に参加した人数
+	Leaves int // 区間内に離脱した人数
+	Active int // 区間の終わりの時点で参加中の人数
+	// Changes は区間内の投票の変更回数
+	Changes int
+	// MeanScore は区間の終わりの時点の平均点。投票がない場合は 0
+	MeanScore float64
+}
+
+// Analytics はイベントの投票と参加状況の集計
+type Analytics struct {
+	EventID      EventID
+	Participants int // 参加したことのあるユーザー数
+	// PeakActive は同時に参加していた人数の最大値。再参加したユーザーは最初の参加から参加していたものとして数える
+	PeakActive int
+	Voters     int // 投票したユーザー数
+	// ParticipationRate は参加者のうち投票したユーザーの割合
+	ParticipationRate float64
+	MeanScore         float64
+	Distribution      []VoteCount
+	// NetScore は「よさみが深い」の割合から「まぁまぁ」「わろし」の割合を引いた値 (-100 から 100)
+	NetScore float64
+	// Interval は Timeline の区間の秒数
+	Interval int
+	Timeline []TimelineBucket
+}
+
+// Report はイベント終了後に主催者へ渡すレポート
+type Report struct {
+	Event     *Event
+	Analytics *Analytics
+	Comments  []Comment
+}
@@ -0,0 +1,17 @@
+package domain
+
+import "errors"
+
+// CommentMaxLength はコメントの最大文字数
+const CommentMaxLength = 200
+
+// ErrCommentTooLong はコメントが CommentMaxLength を超えている
+var ErrCommentTooLong = errors.New("comment is too long")
+
+// Comment は参加者からイベントへのコメント
+type Comment struct {
+	EventID   EventID
+	UserID    UserID
+	Text      string
+	CreatedAt int
+}
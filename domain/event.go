@@ -1,8 +1,33 @@
 package domain
 
+import "errors"
+
 type EventStatus int
 type EventID string
 
+// JoinCodeLength は参加コードの桁数
+const JoinCodeLength = 6
+
+// PasscodeLength は非公開イベントのパスコードの桁数
+const PasscodeLength = 4
+
+// パスコード入力の失敗はこの期間内に指定回数まで許容する
+const (
+	PasscodeFailureWindow = 10 * 60
+	PasscodeFailureLimit  = 5
+)
+
+var (
+	// ErrTooManyPasscodeFailures はパスコード入力の失敗が上限に達した場合のエラー
+	ErrTooManyPasscodeFailures = errors.New("too many passcode failures")
+	// ErrEventNotOpen はイベントがまだ開催されていない場合のエラー
+	ErrEventNotOpen = errors.New("event is not open yet")
+	// ErrEventClosed はイベントが既に終了している場合のエラー
+	ErrEventClosed = errors.New("event is already closed")
+	// ErrVotingClosed は投票の受付時間外に投票した場合のエラー
+	ErrVotingClosed = errors.New("voting is not open")
+)
+
 const (
 	EVENT_STABDBY EventStatus = iota
 	EVENT_OPEN
@@ -13,6 +38,64 @@ type Event struct {
 	ID        EventID
 	OwnerID   OwnerID
 	Status    EventStatus
+	Title     string
+	JoinCode  string
+	IsPrivate bool
+	Passcode  string
+	// IsVoting は主催者が投票の受付を開始しているかどうか
+	IsVoting bool
+	// VoteClosesAt は投票の締め切り時刻。0 の場合は主催者が締め切るまで受け付ける
+	VoteClosesAt int
+	// VoteOpenedAt は投票の受付を最後に開始した時刻
+	VoteOpenedAt int
+	VotePolicy   VotePolicy
+	// OpenedAt は開催した時刻。CreatedAt はスタンバイとして登録した時刻
+	OpenedAt  int
 	CreatedAt int
 	UpdatedAt int
 }
+
+// IsVoteOpen は now の時点で投票を受け付けているかどうかを返します
+func (e *Event) IsVoteOpen(now int) bool {
+	if e.Status != EVENT_OPEN || !e.IsVoting {
+		return false
+	}
+	return e.VoteClosesAt == 0 || now < e.VoteClosesAt
+}
+
+type EventOrder int
+
+const (
+	EVENT_ORDER_NEWEST EventOrder = iota
+	EVENT_ORDER_OLDEST
+	EVENT_ORDER_PARTICIPANTS
+)
+
+// EventListQuery はイベント一覧の取得条件
+type EventListQuery struct {
+	Status         *EventStatus
+	IncludePrivate bool
+	Order          EventOrder
+	Offset         int
+	Limit          int // 0 の場合は全件
+}
+
+// EventSummary は一覧表示用のイベント情報
+type EventSummary struct {
+	Event
+	OwnerName        string
+	ParticipantCount int
+}
+
+// IsJoinCode は文字列が参加コードの形式かどうかを返します
+func IsJoinCode(s string) bool {
+	if len(s) != JoinCodeLength {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package domain
+
+import "testing"
+
+func TestIsVoteOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		now   int
+		want  bool
+	}{
+		{"standby", Event{Status: EVENT_STABDBY, IsVoting: true}, 100, false},
+		{"closed event", Event{Status: EVENT_CLOSED, IsVoting: true}, 100, false},
+		{"not voting", Event{Status: EVENT_OPEN}, 100, false},
+		{"no deadline", Event{Status: EVENT_OPEN, IsVoting: true}, 100, true},
+		{"before deadline", Event{Status: EVENT_OPEN, IsVoting: true, VoteClosesAt: 101}, 100, true},
+		{"at deadline", Event{Status: EVENT_OPEN, IsVoting: true, VoteClosesAt: 100}, 100, false},
+		{"after deadline", Event{Status: EVENT_OPEN, IsVoting: true, VoteClosesAt: 99}, 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.IsVoteOpen(tt.now); got != tt.want {
+				t.Errorf("IsVoteOpen(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package domain
+
+type OrganizerRole int
+
+const (
+	ORGANIZER_PRIMARY OrganizerRole = iota
+	ORGANIZER_CO
+)
+
+// Organizer はイベントの主催者(共同主催者を含む)
+type Organizer struct {
+	EventID EventID
+	OwnerID OwnerID
+	Role    OrganizerRole
+	// DisplayName はフォロー時に記録した表示名。一覧の取得時のみ設定する
+	DisplayName string
+	CreatedAt   int
+	UpdatedAt   int
+}
+
+// Invitation は共同主催者を招待するためのコード
+type Invitation struct {
+	Code      string
+	EventID   EventID
+	OwnerID   OwnerID
+	CreatedAt int
+	UpdatedAt int
+}
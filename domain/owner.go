@@ -3,7 +3,8 @@ package domain
 type OwnerID string
 
 type Owner struct {
-	ID        OwnerID
-	CreatedAt int
-	UpdatedAt int
+	ID          OwnerID
+	DisplayName string
+	CreatedAt   int
+	UpdatedAt   int
 }
@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/mochisuna/linebot-sample/domain"
+)
+
+type CommentRepository interface {
+	SelectByEventID(context.Context, domain.EventID) ([]domain.Comment, error)
+	Create(context.Context, *domain.Comment) error
+}
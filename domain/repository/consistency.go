@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+)
+
+type primaryKey struct{}
+type actorKey struct{}
+
+// WithPrimary はレプリカではなくマスターから読み込むよう指定した context を返します
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// IsPrimary はマスターからの読み込みが指定されているかどうかを返します
+func IsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// WithActor は操作しているユーザーを context に設定します
+// 同じユーザーの書き込み直後の読み込みはマスターへ向けられます
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext は操作しているユーザーを返します
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
@@ -2,16 +2,19 @@ package repository
 
 import (
 	"context"
-	"database/sql"
 
 	"github.com/mochisuna/linebot-sample/domain"
 )
 
 type EventRepository interface {
-	WithTransaction(ctx context.Context, txFunc func(*sql.Tx) error) error
-	SelectByOwnerID(domain.OwnerID, *domain.EventStatus) (*domain.Event, error)
-	SelectByEventID(domain.EventID) (*domain.Event, error)
-	SelectList(*domain.EventStatus) ([]domain.Event, error)
-	Update(*domain.Event, *sql.Tx) error
-	Create(*domain.Event, *sql.Tx) error
+	SelectByOwnerID(context.Context, domain.OwnerID, *domain.EventStatus) (*domain.Event, error)
+	SelectByOrganizerID(context.Context, domain.OwnerID, *domain.EventStatus) (*domain.Event, error)
+	SelectByEventID(context.Context, domain.EventID) (*domain.Event, error)
+	SelectByJoinCode(context.Context, string) (*domain.Event, error)
+	SelectList(context.Context, *domain.EventListQuery) ([]domain.EventSummary, error)
+	Update(context.Context, *domain.Event) error
+	Create(context.Context, *domain.Event) error
+	CountPasscodeFailures(context.Context, domain.EventID, domain.UserID, int) (int, error)
+	CreatePasscodeFailure(context.Context, domain.EventID, domain.UserID, int) error
+	CountByStatus(context.Context, domain.EventStatus) (int, error)
 }
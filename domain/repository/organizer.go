@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/mochisuna/linebot-sample/domain"
+)
+
+type OrganizerRepository interface {
+	Select(context.Context, domain.EventID, domain.OwnerID) (*domain.Organizer, error)
+	SelectList(context.Context, domain.EventID) ([]domain.Organizer, error)
+	SelectInvitation(context.Context, string) (*domain.Invitation, error)
+	SelectInvitationByEventID(context.Context, domain.EventID) (*domain.Invitation, error)
+	Create(context.Context, *domain.Organizer) error
+	Delete(context.Context, *domain.Organizer) error
+	CreateInvitation(context.Context, *domain.Invitation) error
+	DeleteInvitation(context.Context, domain.EventID) error
+}
@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"context"
+)
+
+// TxManager は複数のリポジトリにまたがる処理を1つのトランザクションで実行します
+// fn に渡される context を各リポジトリに渡すことで同じトランザクションに参加します
+type TxManager interface {
+	Do(ctx context.Context, fn func(context.Context) error) error
+}
@@ -2,16 +2,23 @@ package repository
 
 import (
 	"context"
-	"database/sql"
 
 	"github.com/mochisuna/linebot-sample/domain"
 )
 
 type UserRepository interface {
-	WithTransaction(ctx context.Context, txFunc func(*sql.Tx) error) error
-	Select(*domain.UserID, *domain.EventID) (*domain.User, error)
-	SelectByIDAndStatus(*domain.UserID, bool) (*domain.User, error)
-	Update(*domain.User, *sql.Tx) error
-	Participate(*domain.User, *sql.Tx) error
-	Vote(*domain.User, *sql.Tx) error
+	Select(context.Context, *domain.UserID, *domain.EventID) (*domain.User, error)
+	SelectByIDAndStatus(context.Context, *domain.UserID, bool) (*domain.User, error)
+	SelectContext(context.Context, domain.UserID) (*domain.UserContext, error)
+	Update(context.Context, *domain.User) error
+	LeaveByEventID(context.Context, domain.EventID, int) error
+	Participate(context.Context, *domain.User) error
+	Vote(context.Context, *domain.User) error
+	SelectVote(context.Context, *domain.UserID, *domain.EventID) (*domain.User, error)
+	CreateVoteHistory(context.Context, *domain.VoteHistory) error
+	SelectVoteHistories(context.Context, domain.EventID) ([]domain.VoteHistory, error)
+	SelectVotes(context.Context, domain.EventID) ([]domain.User, error)
+	SelectParticipants(context.Context, domain.EventID) ([]domain.User, error)
+	CountParticipants(context.Context) (int, error)
+	SelectParticipantIDs(context.Context, domain.EventID) ([]domain.UserID, error)
 }
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/domain"
+)
+
+type AnalyticsService interface {
+	GetEventAnalytics(context.Context, domain.EventID, time.Duration) (*domain.Analytics, error)
+}
+
+type ReportService interface {
+	GetReport(context.Context, domain.EventID) (*domain.Report, error)
+}
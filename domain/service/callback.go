@@ -2,19 +2,37 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/mochisuna/linebot-sample/domain"
 )
 
 type CallbackService interface {
-	Follow(context.Context, domain.OwnerID) (*domain.Owner, error)
-	GetEventByOwnerID(domain.OwnerID, domain.EventStatus) (*domain.Event, error)
-	GetActiveEvents() ([]domain.Event, error)
+	Follow(context.Context, domain.OwnerID, string) (*domain.Owner, error)
+	GetEventByOwnerID(context.Context, domain.OwnerID, domain.EventStatus) (*domain.Event, error)
+	GetEventByOrganizerID(context.Context, domain.OwnerID, domain.EventStatus) (*domain.Event, error)
+	GetActiveEvents(context.Context, int, int) ([]domain.EventSummary, error)
 	UpdateEventStatus(context.Context, domain.OwnerID, domain.EventStatus) (*domain.Event, error)
-	RegisterEvent(context.Context, domain.OwnerID) (*domain.Event, error)
-	GetEventByEventID(domain.EventID) (*domain.Event, error)
-	GetParticipatedEvent(domain.UserID) (*domain.User, error)
+	StartEvent(context.Context, domain.OwnerID, bool) (*domain.Event, error)
+	RegisterEvent(context.Context, domain.OwnerID, string) (*domain.Event, error)
+	UpdateEventTitle(context.Context, domain.OwnerID, string) (*domain.Event, error)
+	GetEventByEventID(context.Context, domain.EventID) (*domain.Event, error)
+	GetEventByJoinCode(context.Context, string) (*domain.Event, error)
+	VerifyPasscode(context.Context, *domain.UserID, *domain.Event, string) (bool, error)
+	GetParticipatedEvent(context.Context, domain.UserID) (*domain.User, error)
+	GetUserContext(context.Context, domain.UserID) (*domain.UserContext, error)
 	ParticipateEvent(context.Context, *domain.UserID, *domain.EventID) error
 	LeaveEvent(context.Context, *domain.UserID, *domain.EventID) error
 	VoteEvent(context.Context, *domain.UserID, *domain.EventID, domain.VOTE_STATUS) error
+	OpenVoting(context.Context, domain.OwnerID, time.Duration) (*domain.Event, error)
+	CloseVoting(context.Context, domain.OwnerID) (*domain.Event, error)
+	SetVotePolicy(context.Context, domain.OwnerID, domain.VotePolicy) (*domain.Event, error)
+	GetParticipantIDs(context.Context, domain.EventID) ([]domain.UserID, error)
+	PostComment(context.Context, *domain.UserID, *domain.EventID, string) error
+	GetOrganizer(context.Context, domain.EventID, domain.OwnerID) (*domain.Organizer, error)
+	GetOrganizers(context.Context, domain.EventID) ([]domain.Organizer, error)
+	IssueInvitation(context.Context, domain.EventID, domain.OwnerID) (*domain.Invitation, error)
+	GetInvitation(context.Context, string) (*domain.Invitation, error)
+	AddOrganizer(context.Context, domain.EventID, domain.OwnerID) error
+	RevokeOrganizer(context.Context, domain.EventID, domain.OwnerID) error
 }
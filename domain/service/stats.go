@@ -0,0 +1,11 @@
+package service
+
+import (
+	"context"
+
+	"github.com/mochisuna/linebot-sample/domain"
+)
+
+type StatsService interface {
+	GetStats(context.Context) (*domain.Stats, error)
+}
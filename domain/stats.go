@@ -0,0 +1,7 @@
+package domain
+
+// Stats は運用状況の把握に使う集計値
+type Stats struct {
+	OpenEvents         int
+	ActiveParticipants int
+}
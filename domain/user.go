@@ -1,5 +1,7 @@
 package domain
 
+import "errors"
+
 type VOTE_STATUS int
 type UserID string
 
@@ -19,3 +21,10 @@ type User struct {
 	CreatedAt      int
 	UpdatedAt      int
 }
+
+var (
+	// ErrAlreadyParticipated は同じイベントに参加済みの場合のエラー
+	ErrAlreadyParticipated = errors.New("already participating in this event")
+	// ErrAlreadyParticipating は別のイベントに参加中の場合のエラー
+	ErrAlreadyParticipating = errors.New("already participating in another event")
+)
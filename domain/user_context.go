@@ -0,0 +1,34 @@
+package domain
+
+// UserRole はbotの操作時点でのユーザーの立場
+type UserRole int
+
+const (
+	ROLE_GUEST UserRole = iota
+	ROLE_OWNER
+	ROLE_CO_ORGANIZER
+	ROLE_PARTICIPANT
+)
+
+// UserContext はコマンドの判定に使うユーザーの状態をまとめたもの
+// キャッシュされるため、イベントの Passcode は空の場合がある
+type UserContext struct {
+	UserID UserID
+	Role   UserRole
+	// OwnedEvent は主催(共同主催を含む)している開催中のイベント
+	OwnedEvent *Event
+	// Participation は参加中のイベントの参加情報。Vote に現在の投票が入る
+	Participation *User
+	// ParticipatedEvent は参加中のイベント
+	ParticipatedEvent *Event
+}
+
+// IsOrganizer は開催中のイベントを主催しているかどうかを返します
+func (c *UserContext) IsOrganizer() bool {
+	return c.OwnedEvent != nil
+}
+
+// IsParticipating はイベントに参加中かどうかを返します
+func (c *UserContext) IsParticipating() bool {
+	return c.Participation != nil
+}
@@ -0,0 +1,52 @@
+package domain
+
+import "errors"
+
+// VotePolicy は投票後に投票を変更できるかどうかの方針
+type VotePolicy int
+
+const (
+	// VOTE_POLICY_CHANGEABLE はいつでも変更できる
+	VOTE_POLICY_CHANGEABLE VotePolicy = iota
+	// VOTE_POLICY_LOCKED は最初の投票で確定する
+	VOTE_POLICY_LOCKED
+	// VOTE_POLICY_UNTIL_CLOSE は投票した受付時間内であれば変更できる
+	VOTE_POLICY_UNTIL_CLOSE
+)
+
+var (
+	// ErrVoteLocked は方針により投票を変更できない場合のエラー
+	ErrVoteLocked = errors.New("vote can no longer be changed")
+	// ErrInvalidVote は GREAT から BAD 以外の値で投票した場合のエラー
+	ErrInvalidVote = errors.New("invalid vote")
+)
+
+// IsValid は投票として受け付ける値かどうかを返します。NOT_VOTED は投票として扱わない
+func (v VOTE_STATUS) IsValid() bool {
+	return v >= GREAT && v <= BAD
+}
+
+// VoteHistory は投票の変更履歴
+type VoteHistory struct {
+	EventID      EventID
+	UserID       UserID
+	Vote         VOTE_STATUS
+	PreviousVote VOTE_STATUS // 初めての投票の場合は NOT_VOTED
+	CreatedAt    int
+}
+
+// CanChangeVote は current の投票をイベントの方針に従って変更できるかどうかを返します
+func (e *Event) CanChangeVote(current *User) bool {
+	if current.Vote == NOT_VOTED {
+		return true
+	}
+	switch e.VotePolicy {
+	case VOTE_POLICY_LOCKED:
+		return false
+	case VOTE_POLICY_UNTIL_CLOSE:
+		// 前回の受付時間内の投票は締め切り後に変更できない
+		return current.UpdatedAt >= e.VoteOpenedAt
+	default:
+		return true
+	}
+}
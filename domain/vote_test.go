@@ -0,0 +1,47 @@
+package domain
+
+import "testing"
+
+func TestVoteStatusIsValid(t *testing.T) {
+	tests := []struct {
+		vote VOTE_STATUS
+		want bool
+	}{
+		{NOT_VOTED, false},
+		{GREAT, true},
+		{GOOD, true},
+		{NOT_GOOD, true},
+		{BAD, true},
+		{BAD + 1, false},
+		{-1, false},
+	}
+	for _, tt := range tests {
+		if got := tt.vote.IsValid(); got != tt.want {
+			t.Errorf("VOTE_STATUS(%d).IsValid() = %v, want %v", tt.vote, got, tt.want)
+		}
+	}
+}
+
+func TestCanChangeVote(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  VotePolicy
+		current User
+		want    bool
+	}{
+		{"first vote is always allowed", VOTE_POLICY_LOCKED, User{Vote: NOT_VOTED}, true},
+		{"changeable", VOTE_POLICY_CHANGEABLE, User{Vote: GOOD, UpdatedAt: 50}, true},
+		{"locked", VOTE_POLICY_LOCKED, User{Vote: GOOD, UpdatedAt: 150}, false},
+		{"until close in current window", VOTE_POLICY_UNTIL_CLOSE, User{Vote: GOOD, UpdatedAt: 150}, true},
+		{"until close at window start", VOTE_POLICY_UNTIL_CLOSE, User{Vote: GOOD, UpdatedAt: 100}, true},
+		{"until close in previous window", VOTE_POLICY_UNTIL_CLOSE, User{Vote: GOOD, UpdatedAt: 50}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &Event{VotePolicy: tt.policy, VoteOpenedAt: 100}
+			if got := event.CanChangeVote(&tt.current); got != tt.want {
+				t.Errorf("CanChangeVote(%+v) = %v, want %v", tt.current, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,132 +4,146 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/go-chi/chi/middleware"
 	"github.com/line/line-bot-sdk-go/linebot"
 	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/logger"
 )
 
 // botのアクションのみを統括
 
+// カルーセルは10カラムまでなので次ページ用の1カラムを残しておく
+const eventListPageSize = 9
+
+// ボタンテンプレートはアクション4つまでなので次ページ用の1つを残しておく
+const organizerListPageSize = 3
+
+// マルチキャストで一度に送れる宛先の上限
+const multicastLimit = 500
+
+// 投票の締め切りとして指定できる最大の分数
+const maxVotingMinutes = 180
+
 // getMessageFollowAction はbotをフォローした際に実行されるアクション
 func (s *Server) getMessageFollowAction(ctx context.Context, req *linebot.Event) linebot.SendingMessage {
-	log.Println("called action.getMessageFollowAction")
-	requestID := middleware.GetReqID(ctx)
+	logger.FromContext(ctx).Debug("called action.getMessageFollowAction")
 	ownerID := domain.OwnerID(req.Source.UserID)
-	profile, err := s.Bot.GetProfile(req.Source.UserID).Do()
+	profile, err := s.Bot.GetProfile(req.Source.UserID).WithContext(ctx).Do()
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
+		logError(ctx, err)
 		return linebot.NewTextMessage("プロフィール参照時にエラーが発生しました")
 	}
-	log.Printf("%v| DisplayName = %#v", requestID, profile.DisplayName)
+	logger.FromContext(ctx).Debug("profile", "display_name", profile.DisplayName)
 
-	ref, err := s.CallbackService.Follow(ctx, ownerID)
-	log.Printf("%v| %#v", requestID, ref)
+	_, err = s.CallbackService.Follow(ctx, ownerID, profile.DisplayName)
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
+		logError(ctx, err)
 		return linebot.NewTextMessage("登録時にエラーが発生しました")
 	}
 	return linebot.NewTextMessage(profile.DisplayName + "様。\n登録ありがとうございます。")
 }
 
-// isOwnerOfEvent は自分がオーナーのイベントがあるかどうかを返します
-func (s *Server) isOwnerOfEvent(ownerID domain.OwnerID) (bool, error) {
-	log.Println("called action.isOwnerOfEvent")
-	_, err := s.CallbackService.GetEventByOwnerID(ownerID, domain.EVENT_OPEN)
-	if err != nil {
-		if err != sql.ErrNoRows {
-			return false, err
-		}
-		// sql.ErrNoRows ならすぐに返却してよい
-		return false, nil
-	}
-	return true, nil
-}
-
 // getMessageOpenEvent イベント開催アクション
-func (s *Server) getMessageOpenEvent(ctx context.Context, req *linebot.Event) linebot.SendingMessage {
-	log.Println("called action.getMessageOpenEvent")
-	requestID := middleware.GetReqID(ctx)
-	ownerID := domain.OwnerID(req.Source.UserID)
+// タイトルが指定された場合はスタンバイ中のイベントのタイトルとして設定します
+func (s *Server) getMessageOpenEvent(ctx context.Context, uc *domain.UserContext, title string) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageOpenEvent")
+	ownerID := domain.OwnerID(uc.UserID)
+	// カルーセルのタイトルに収まる長さにしておく
+	title = truncate(title, 40)
 
-	owned, err := s.isOwnerOfEvent(ownerID)
-	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("イベント参照時にエラーが発生しました")
-	}
-	if owned {
+	if uc.IsOrganizer() {
 		return linebot.NewTextMessage("あなたが主催のイベントが開催中です")
 	}
-	user, err := s.CallbackService.GetParticipatedEvent(domain.UserID(ownerID))
-	if err != nil {
-		if err != sql.ErrNoRows {
-			log.Printf("%v| error reason: %#v", requestID, err.Error())
-			return linebot.NewTextMessage("参加イベント照会時にエラーが発生しました")
-		}
-	}
-	if user.IsParticipated {
-		log.Printf("%v| error in participated event: %#v", requestID, user.EventID)
+	if uc.IsParticipating() {
+		logger.FromContext(ctx).Error("error in participated event", "event_id", uc.Participation.EventID)
+		setResult(ctx, resultConflict)
 		return linebot.NewTextMessage("あなたは既に別のイベントに参加しています")
 	}
-	_, err = s.CallbackService.GetEventByOwnerID(ownerID, domain.EVENT_STABDBY)
+	_, err := s.CallbackService.GetEventByOwnerID(ctx, ownerID, domain.EVENT_STABDBY)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// スタンバイ状態ですら存在しない場合はイベントを作成
-			_, err = s.CallbackService.RegisterEvent(ctx, ownerID)
+			_, err = s.CallbackService.RegisterEvent(ctx, ownerID, title)
 			if err != nil {
-				log.Printf("%v| error reason: %#v", requestID, err.Error())
+				logError(ctx, err)
 				return linebot.NewTextMessage("イベントスタンバイ時にエラーが発生しました")
 			}
 		} else {
-			log.Printf("%v| error reason: %#v", requestID, err.Error())
+			logError(ctx, err)
 			return linebot.NewTextMessage("イベント参照時にエラーが発生しました")
 		}
+	} else if title != "" {
+		if _, err = s.CallbackService.UpdateEventTitle(ctx, ownerID, title); err != nil {
+			logError(ctx, err)
+			return linebot.NewTextMessage("イベントスタンバイ時にエラーが発生しました")
+		}
 	}
 
-	return linebot.NewTemplateMessage(
-		"start event",
-		linebot.NewConfirmTemplate(
-			"イベントを開催しますか？",
-			linebot.NewMessageAction("開催する", ActionEventStart),
-			linebot.NewMessageAction("戻る", ActionEventCancel),
-		),
-	)
+	return s.menuMessage(ctx, flexOpen, newOpenMenu())
 }
 
-func (s *Server) getMessageStartEvent(ctx context.Context, req *linebot.Event) linebot.SendingMessage {
-	log.Println("called action.getMessageStartEvent")
-	requestID := middleware.GetReqID(ctx)
-	ownerID := domain.OwnerID(req.Source.UserID)
-	owned, err := s.isOwnerOfEvent(ownerID)
-	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("イベント参照時にエラーが発生しました")
-	}
-	if owned {
-		return linebot.NewTextMessage("あなたが主催のイベントが開催中です")
-	}
-	res, err := s.CallbackService.UpdateEventStatus(ctx, ownerID, domain.EVENT_OPEN)
-	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("ステータス更新時にエラーが発生しました")
+func newOpenMenu() flexMenuData {
+	return flexMenuData{
+		Title: "イベント開催",
+		Text:  "イベントを開催しますか？\n非公開イベントは一覧に表示されません",
+		Options: []flexMenuOption{
+			{Label: "開催する", Text: ActionEventStart},
+			{Label: "非公開で開催する", Text: ActionEventStartPrivate},
+			{Label: "戻る", Text: ActionEventCancel},
+		},
 	}
-	msg := fmt.Sprintf("イベントを開催しました。\nイベント番号:\n%v\nを参加者に共有しましょう", res.ID)
-	return linebot.NewTextMessage(msg)
 }
 
-func (s *Server) getMessageCloseEvent(ctx context.Context, req *linebot.Event) linebot.SendingMessage {
-	log.Println("called action.getMessageCloseEvent")
-	requestID := middleware.GetReqID(ctx)
-	ownerID := domain.OwnerID(req.Source.UserID)
-	owned, err := s.isOwnerOfEvent(ownerID)
+// getMessagesStartEvent はイベントを開催し、参加用のQRコード画像も合わせて返します
+func (s *Server) getMessagesStartEvent(ctx context.Context, uc *domain.UserContext, isPrivate bool) []linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessagesStartEvent")
+	ownerID := domain.OwnerID(uc.UserID)
+	if uc.IsOrganizer() {
+		return []linebot.SendingMessage{linebot.NewTextMessage("あなたが主催のイベントが開催中です")}
+	}
+	res, err := s.CallbackService.StartEvent(ctx, ownerID, isPrivate)
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("イベント参照時にエラーが発生しました")
-	}
-	if !owned {
+		logError(ctx, err)
+		return []linebot.SendingMessage{linebot.NewTextMessage("ステータス更新時にエラーが発生しました")}
+	}
+	data := flexStartedData{
+		Title:    eventTitle(res),
+		JoinCode: res.JoinCode,
+		EventID:  string(res.ID),
+		Command:  ActionEventParticipate + " " + res.JoinCode,
+	}
+	if res.IsPrivate {
+		// 非公開イベントは参加コードとパスコードでのみ参加できるのでリンクやQRコードは発行しない
+		data.Passcode = res.Passcode
+		data.Command += " " + res.Passcode
+		data.ShareURL = lineShareURL(fmt.Sprintf("「%v」には「%v」と送信して参加してください", data.Title, data.Command))
+		msg := fmt.Sprintf("非公開イベントを開催しました。\n参加コード: %v\nパスコード: %v\n参加者には「%v」と送信してもらいましょう", res.JoinCode, res.Passcode, data.Command)
+		return []linebot.SendingMessage{s.flexMessage(ctx, flexStarted, data, msg)}
+	}
+	msg := fmt.Sprintf("イベントを開催しました。\n参加コード: %v\nイベント番号:\n%v\nを参加者に共有しましょう", res.JoinCode, res.ID)
+	share := fmt.Sprintf("「%v」には「%v」と送信して参加してください", data.Title, data.Command)
+	if link := s.participateLink(res.ID); link != "" {
+		msg += "\n参加用リンク:\n" + link
+		share = fmt.Sprintf("「%v」には次のリンクから参加してください\n%v", data.Title, link)
+	}
+	data.ShareURL = lineShareURL(share)
+	messages := []linebot.SendingMessage{s.flexMessage(ctx, flexStarted, data, msg)}
+	if s.BaseURL != "" && s.BasicID != "" {
+		messages = append(messages, linebot.NewImageMessage(
+			s.qrCodeURL(res.ID, qrCodeOriginalSize),
+			s.qrCodeURL(res.ID, qrCodePreviewSize),
+		))
+	}
+	return messages
+}
+
+func (s *Server) getMessageCloseEvent(ctx context.Context, uc *domain.UserContext) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageCloseEvent")
+	if !uc.IsOrganizer() {
 		return linebot.NewTextMessage("あなたはまだイベントを主催していません")
 	}
 	return linebot.NewTemplateMessage(
@@ -142,146 +156,211 @@ func (s *Server) getMessageCloseEvent(ctx context.Context, req *linebot.Event) l
 	)
 }
 
-func (s *Server) getMessageFinishEvent(ctx context.Context, req *linebot.Event) linebot.SendingMessage {
-	log.Println("called action.getMessageFinishEvent")
-	requestID := middleware.GetReqID(ctx)
-	ownerID := domain.OwnerID(req.Source.UserID)
-	owned, err := s.isOwnerOfEvent(ownerID)
-	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("イベント参照時にエラーが発生しました")
-	}
-	if !owned {
+func (s *Server) getMessageFinishEvent(ctx context.Context, uc *domain.UserContext) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageFinishEvent")
+	if !uc.IsOrganizer() {
 		return linebot.NewTextMessage("あなたはまだイベントを主催していません")
 	}
-	_, err = s.CallbackService.UpdateEventStatus(ctx, ownerID, domain.EVENT_CLOSED)
+	event, err := s.CallbackService.UpdateEventStatus(ctx, domain.OwnerID(uc.UserID), domain.EVENT_CLOSED)
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
+		logError(ctx, err)
 		return linebot.NewTextMessage("ステータス更新時にエラーが発生しました")
 	}
-	return linebot.NewTextMessage("イベントを終了しました")
+	data := flexFinishData{Title: eventTitle(event)}
+	link, expires := s.reportURL(event.ID, time.Now())
+	if link == "" {
+		return s.flexMessage(ctx, flexFinish, data, "イベントを終了しました")
+	}
+	data.ReportURL, data.Expires = link, expires.Format(reportTimeLayout)
+	return s.flexMessage(ctx, flexFinish, data, fmt.Sprintf("イベントを終了しました\nレポート (%vまで有効)\n%v", data.Expires, link))
 }
 
-func (s *Server) getMessageEvents(ctx context.Context, req *linebot.Event) linebot.SendingMessage {
-	log.Println("called action.getMessageEvents")
-	requestID := middleware.GetReqID(ctx)
-	userID := domain.UserID(req.Source.UserID)
-	owned, err := s.isOwnerOfEvent(domain.OwnerID(userID))
-	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("イベント参照時にエラーが発生しました")
-	}
-	if owned {
+// getMessageEvents 開催中イベントの一覧を1ページ分カルーセルで返すアクション
+func (s *Server) getMessageEvents(ctx context.Context, uc *domain.UserContext, page int) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageEvents")
+	if uc.IsOrganizer() {
 		return linebot.NewTextMessage("あなたが主催のイベントが開催中です")
 	}
-	user, err := s.CallbackService.GetParticipatedEvent(userID)
-	if err != nil {
-		if err != sql.ErrNoRows {
-			log.Printf("%v| error reason: %#v", requestID, err.Error())
-			return linebot.NewTextMessage("参加イベント情報取得時にエラーが発生しました")
-		}
-	}
-	if user.IsParticipated {
-		log.Printf("%v| error in participated event: %#v", requestID, user.EventID)
+	if uc.IsParticipating() {
+		logger.FromContext(ctx).Error("error in participated event", "event_id", uc.Participation.EventID)
+		setResult(ctx, resultConflict)
 		return linebot.NewTextMessage("あなたは既にどこかのイベントに参加しています")
 	}
 
-	events, err := s.CallbackService.GetActiveEvents()
+	if page < 1 {
+		page = 1
+	}
+	// 次ページの有無を判定するため1件多く取得する
+	events, err := s.CallbackService.GetActiveEvents(ctx, (page-1)*eventListPageSize, eventListPageSize+1)
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
+		logError(ctx, err)
 		return linebot.NewTextMessage("開催イベント情報取得時にエラーが発生しました")
 	} else if len(events) < 1 {
+		if page > 1 {
+			return linebot.NewTextMessage("これ以上開催中のイベントはありません")
+		}
 		return linebot.NewTextMessage("開催中のイベントが存在しません")
 	}
+	hasNext := len(events) > eventListPageSize
+	if hasNext {
+		events = events[:eventListPageSize]
+	}
 
-	actions := []linebot.TemplateAction{}
+	data := flexEventsData{}
 	for _, ev := range events {
-		if ev.Status != domain.EVENT_OPEN {
-			continue
+		ownerName := ev.OwnerName
+		if ownerName == "" {
+			ownerName = "-"
 		}
-		action := linebot.NewMessageAction(
-			string(ev.ID),
-			ActionEventParticipate+" "+string(ev.ID),
-		)
-		actions = append(actions, action)
+		data.Events = append(data.Events, flexEvent{
+			Title:        eventTitle(&ev.Event),
+			Owner:        ownerName,
+			Participants: ev.ParticipantCount,
+			Text:         ActionEventParticipate + " " + string(ev.ID),
+		})
+	}
+	if hasNext {
+		next := url.Values{}
+		next.Set("action", ActionEventList)
+		next.Set("page", strconv.Itoa(page+1))
+		data.Next = next.Encode()
 	}
 
-	return linebot.NewTemplateMessage(
-		"start event",
-		linebot.NewButtonsTemplate(
-			"",
-			"開催中のイベント",
-			"参加したいイベントIDを選んでください",
-			actions...,
-		),
-	)
+	return s.flexMessage(ctx, flexEvents, data, "開催イベント情報の表示時にエラーが発生しました")
 }
 
-func (s *Server) getMessageParticipateEvent(ctx context.Context, req *linebot.Event, eventID domain.EventID) linebot.SendingMessage {
-	log.Println("called action.getMessageParticipateEvent")
-	requestID := middleware.GetReqID(ctx)
-	userID := domain.UserID(req.Source.UserID)
-	owned, err := s.isOwnerOfEvent(domain.OwnerID(userID))
-	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("イベント参照時にエラーが発生しました")
+// eventTitle はイベントの表示名を返します。タイトル未設定の場合は参加コードを使います
+func eventTitle(event *domain.Event) string {
+	if event.Title != "" {
+		return event.Title
 	}
-	if owned {
+	if event.JoinCode != "" {
+		return "イベント " + event.JoinCode
+	}
+	return string(event.ID)
+}
+
+// truncate はテンプレートの文字数制限に合わせて文字列を切り詰めます
+func truncate(str string, max int) string {
+	if runes := []rune(str); len(runes) > max {
+		return string(runes[:max])
+	}
+	return str
+}
+
+// findEvent は参加コードまたはイベントIDからイベントを取得します
+func (s *Server) findEvent(ctx context.Context, key string) (*domain.Event, error) {
+	if domain.IsJoinCode(key) {
+		return s.CallbackService.GetEventByJoinCode(ctx, key)
+	}
+	return s.CallbackService.GetEventByEventID(ctx, domain.EventID(key))
+}
+
+func (s *Server) getMessageParticipateEvent(ctx context.Context, uc *domain.UserContext, key string, passcode string) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageParticipateEvent")
+	userID := uc.UserID
+	if uc.IsOrganizer() {
 		return linebot.NewTextMessage("あなたが主催のイベントが開催中です")
 	}
-	event, err := s.CallbackService.GetEventByEventID(eventID)
+	event, err := s.findEvent(ctx, key)
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
+		if err == sql.ErrNoRows {
+			setResult(ctx, resultNotFound)
+			return linebot.NewTextMessage("指定されたイベントが見つかりません")
+		}
+		logError(ctx, err)
 		return linebot.NewTextMessage("開催イベント情報取得時にエラーが発生しました")
 	}
 	if event.Status == domain.EVENT_STABDBY {
+		setResult(ctx, resultInvalidState)
 		return linebot.NewTextMessage("このイベントはまだ開催していません")
 	}
 	if event.Status == domain.EVENT_CLOSED {
+		setResult(ctx, resultInvalidState)
 		return linebot.NewTextMessage("このイベントはすでに終了しています")
 	}
-	user, err := s.CallbackService.GetParticipatedEvent(userID)
-	if err != nil {
-		if err != sql.ErrNoRows {
-			log.Printf("%v| error reason: %#v", requestID, err.Error())
-			return linebot.NewTextMessage("参加イベント情報取得時にエラーが発生しました")
+	if event.IsPrivate {
+		if !domain.IsJoinCode(key) || passcode == "" {
+			setResult(ctx, resultRejected)
+			return linebot.NewTextMessage("非公開イベントには参加コードとパスコードで参加してください")
+		}
+		ok, err := s.CallbackService.VerifyPasscode(ctx, &userID, event, passcode)
+		if err != nil {
+			if err == domain.ErrTooManyPasscodeFailures {
+				setResult(ctx, resultRateLimited)
+				return linebot.NewTextMessage("パスコードの入力に続けて失敗したため、しばらく時間をおいてからお試しください")
+			}
+			logError(ctx, err)
+			return linebot.NewTextMessage("パスコード照合時にエラーが発生しました")
+		}
+		if !ok {
+			setResult(ctx, resultRejected)
+			return linebot.NewTextMessage("パスコードが正しくありません")
 		}
 	}
-	if user.EventID == event.ID {
-		log.Printf("%v| error in participated event: %#v", requestID, event.ID)
+
+	err = s.CallbackService.ParticipateEvent(ctx, &userID, &event.ID)
+	switch err {
+	case nil:
+		return linebot.NewTextMessage("イベントに参加しました")
+	case domain.ErrAlreadyParticipated:
+		logger.FromContext(ctx).Error("error in participated event", "event_id", event.ID)
+		setResult(ctx, resultConflict)
 		return linebot.NewTextMessage("あなたは既にこのイベントに参加しています")
-	} else if user.IsParticipated {
-		log.Printf("%v| error in participated event: %#v", requestID, event.ID)
+	case domain.ErrAlreadyParticipating:
+		logger.FromContext(ctx).Error("error in participated event", "event_id", event.ID)
+		setResult(ctx, resultConflict)
 		return linebot.NewTextMessage("あなたは既に別のイベントに参加しています")
-	}
-
-	if err = s.CallbackService.ParticipateEvent(ctx, &userID, &eventID); err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
+	case domain.ErrEventNotOpen:
+		setResult(ctx, resultInvalidState)
+		return linebot.NewTextMessage("このイベントはまだ開催していません")
+	case domain.ErrEventClosed:
+		setResult(ctx, resultInvalidState)
+		return linebot.NewTextMessage("このイベントはすでに終了しています")
+	default:
+		logError(ctx, err)
 		return linebot.NewTextMessage("イベント参加時にエラーが発生しました")
 	}
-	return linebot.NewTextMessage("イベントに参加しました")
 }
 
-func (s *Server) getMessageLeaveEvent(ctx context.Context, req *linebot.Event) linebot.SendingMessage {
-	log.Println("called action.getMessageLeaveEvent")
-	requestID := middleware.GetReqID(ctx)
-	userID := domain.UserID(req.Source.UserID)
-	user, err := s.CallbackService.GetParticipatedEvent(userID)
-	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		if err == sql.ErrNoRows {
-			return linebot.NewTextMessage("あなたはまだイベントに参加していません")
-		}
-		return linebot.NewTextMessage("参加イベント情報取得時にエラーが発生しました")
+func (s *Server) getMessageLeaveEvent(ctx context.Context, uc *domain.UserContext) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageLeaveEvent")
+	if !uc.IsParticipating() {
+		return linebot.NewTextMessage("あなたはまだイベントに参加していません")
 	}
-	if err = s.CallbackService.LeaveEvent(ctx, &userID, &user.EventID); err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
+	if err := s.CallbackService.LeaveEvent(ctx, &uc.UserID, &uc.Participation.EventID); err != nil {
+		logError(ctx, err)
 		return linebot.NewTextMessage("イベント参加時にエラーが発生しました")
 	}
 	return linebot.NewTextMessage("イベントから離脱しました")
 
 }
 
+// getMessagePostComment 参加中のイベントにコメントを残すアクション
+func (s *Server) getMessagePostComment(ctx context.Context, uc *domain.UserContext, text string) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessagePostComment")
+	if !uc.IsParticipating() {
+		return linebot.NewTextMessage("あなたはまだイベントに参加していません")
+	}
+	if text == "" {
+		return linebot.NewTextMessage("comment の後にコメントを入力してください")
+	}
+	err := s.CallbackService.PostComment(ctx, &uc.UserID, &uc.Participation.EventID, text)
+	switch err {
+	case nil:
+		return linebot.NewTextMessage("コメントを送信しました")
+	case domain.ErrCommentTooLong:
+		setResult(ctx, resultRejected)
+		return linebot.NewTextMessage(fmt.Sprintf("コメントは%v文字以内で入力してください", domain.CommentMaxLength))
+	case domain.ErrEventClosed:
+		setResult(ctx, resultRejected)
+		return linebot.NewTextMessage("イベントは既に終了しています")
+	default:
+		logError(ctx, err)
+		return linebot.NewTextMessage("コメント送信時にエラーが発生しました")
+	}
+}
+
 func voteString(vote domain.VOTE_STATUS) string {
 	ret := ""
 	switch vote {
@@ -298,74 +377,377 @@ func voteString(vote domain.VOTE_STATUS) string {
 }
 
 // getMessageOpenEvent イベント開催アクション
-func (s *Server) getMessageVoteList(ctx context.Context, req *linebot.Event) linebot.SendingMessage {
-	log.Println("called action.getMessageVoteList")
-	requestID := middleware.GetReqID(ctx)
-	userID := domain.UserID(req.Source.UserID)
-	owned, err := s.isOwnerOfEvent(domain.OwnerID(userID))
+func (s *Server) getMessageVoteList(ctx context.Context, uc *domain.UserContext) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageVoteList")
+	if uc.IsOrganizer() {
+		return linebot.NewTextMessage("あなたが主催のイベントが開催中です")
+	}
+	if !uc.IsParticipating() {
+		return linebot.NewTextMessage("あなたはまだイベントに参加していません")
+	}
+	if !uc.ParticipatedEvent.IsVoteOpen(int(time.Now().Unix())) {
+		setResult(ctx, resultInvalidState)
+		return linebot.NewTextMessage("現在は投票を受け付けていません")
+	}
+
+	return s.voteTemplate(ctx, "このイベントについて投票します")
+}
+
+// voteTemplate は投票ボタンのメッセージを返します
+func (s *Server) voteTemplate(ctx context.Context, text string) linebot.SendingMessage {
+	data := newFlexVoteData(text)
+	lines := []string{text}
+	for _, option := range data.Options {
+		lines = append(lines, fmt.Sprintf("%v: %v", option.Label, option.Text))
+	}
+	return s.flexMessage(ctx, flexVote, data, strings.Join(lines, "\n"))
+}
+
+// getMessageOpenEvent イベント開催アクション
+func (s *Server) getMessageVoteEvent(ctx context.Context, uc *domain.UserContext, votes string) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageVoteEvent")
+
+	vote, err := strconv.Atoi(votes)
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("イベント参照時にエラーが発生しました")
+		setResult(ctx, resultRejected)
+		return invalidVoteMessage()
 	}
-	if owned {
+	if uc.IsOrganizer() {
 		return linebot.NewTextMessage("あなたが主催のイベントが開催中です")
 	}
-	_, err = s.CallbackService.GetParticipatedEvent(userID)
+	if !uc.IsParticipating() {
+		return linebot.NewTextMessage("あなたはまだイベントに参加していません")
+	}
+	status := domain.VOTE_STATUS(vote)
+	err = s.CallbackService.VoteEvent(ctx, &uc.UserID, &uc.Participation.EventID, status)
+	if err == domain.ErrVotingClosed {
+		setResult(ctx, resultInvalidState)
+		return linebot.NewTextMessage("現在は投票を受け付けていません")
+	} else if err == domain.ErrVoteLocked {
+		setResult(ctx, resultRejected)
+		return linebot.NewTextMessage("このイベントでは投票を変更できません")
+	} else if err == domain.ErrInvalidVote {
+		setResult(ctx, resultRejected)
+		return invalidVoteMessage()
+	} else if err != nil {
+		logError(ctx, err)
+		return linebot.NewTextMessage("投票時にエラーが発生しました")
+	}
+
+	return linebot.NewTextMessage(voteString(status) + "に投票しました")
+}
+
+// invalidVoteMessage は投票できる値を案内します
+func invalidVoteMessage() linebot.SendingMessage {
+	lines := []string{fmt.Sprintf("投票は%#v〜%#vの数字で送信してください", domain.GREAT, domain.BAD)}
+	for _, option := range newFlexVoteData("").Options {
+		lines = append(lines, fmt.Sprintf("%v: %v", option.Label, option.Text))
+	}
+	return linebot.NewTextMessage(strings.Join(lines, "\n"))
+}
+
+// getMessageOpenVoting 投票の受付を開始し、参加者に通知するアクション
+// minutes が指定された場合はその分数で締め切ります
+func (s *Server) getMessageOpenVoting(ctx context.Context, uc *domain.UserContext, minutes string) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageOpenVoting")
+	if !uc.IsOrganizer() {
+		return linebot.NewTextMessage("あなたはまだイベントを主催していません")
+	}
+	var duration time.Duration
+	if minutes != "" {
+		n, err := strconv.Atoi(minutes)
+		if err != nil || n < 1 || n > maxVotingMinutes {
+			setResult(ctx, resultRejected)
+			return linebot.NewTextMessage(fmt.Sprintf("締め切りまでの分数は1から%vの数字で指定してください", maxVotingMinutes))
+		}
+		duration = time.Duration(n) * time.Minute
+	}
+	event, err := s.CallbackService.OpenVoting(ctx, domain.OwnerID(uc.UserID), duration)
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		if err == sql.ErrNoRows {
-			return linebot.NewTextMessage("あなたはまだイベントに参加していません")
+		logError(ctx, err)
+		return linebot.NewTextMessage("投票開始時にエラーが発生しました")
+	}
+
+	data := flexVotingData{
+		Title: eventTitle(event),
+		Text:  "投票の受付を開始しました",
+	}
+	text := data.Text
+	if event.VoteClosesAt > 0 {
+		data.ClosesAt = time.Unix(int64(event.VoteClosesAt), 0).Format(reportTimeLayout)
+		text = fmt.Sprintf("投票の受付を開始しました。%v分後に締め切ります", int(duration/time.Minute))
+	}
+	// 参加者への通知は件数が多いと時間がかかるので返信とは分けて送る
+	s.goBackground(func(bgCtx context.Context) {
+		s.announceVoting(logger.WithContext(bgCtx, logger.FromContext(ctx)), event, int(duration/time.Minute))
+	})
+	return s.flexMessage(ctx, flexVoting, data, text)
+}
+
+// getMessageCloseVoting 投票の受付を締め切るアクション
+func (s *Server) getMessageCloseVoting(ctx context.Context, uc *domain.UserContext) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageCloseVoting")
+	if !uc.IsOrganizer() {
+		return linebot.NewTextMessage("あなたはまだイベントを主催していません")
+	}
+	event, err := s.CallbackService.CloseVoting(ctx, domain.OwnerID(uc.UserID))
+	if err != nil {
+		logError(ctx, err)
+		return linebot.NewTextMessage("投票締め切り時にエラーが発生しました")
+	}
+	data := flexVotingData{
+		Title: eventTitle(event),
+		Text:  "投票の受付を締め切りました",
+	}
+	return s.flexMessage(ctx, flexVoting, data, data.Text)
+}
+
+// 投票の変更可否の方針のコマンド上の名前と表示名
+var votePolicies = []struct {
+	name   string
+	label  string
+	policy domain.VotePolicy
+}{
+	{"change", "いつでも変更可", domain.VOTE_POLICY_CHANGEABLE},
+	{"lock", "最初の投票で確定", domain.VOTE_POLICY_LOCKED},
+	{"window", "受付時間内のみ変更可", domain.VOTE_POLICY_UNTIL_CLOSE},
+}
+
+// getMessageVotePolicyList 投票の変更可否の方針を選ぶアクション
+func (s *Server) getMessageVotePolicyList(ctx context.Context, uc *domain.UserContext) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageVotePolicyList")
+	if !uc.IsOrganizer() {
+		return linebot.NewTextMessage("あなたはまだイベントを主催していません")
+	}
+	return s.menuMessage(ctx, flexVotePolicy, newVotePolicyMenu(uc.OwnedEvent.VotePolicy))
+}
+
+func newVotePolicyMenu(current domain.VotePolicy) flexMenuData {
+	data := flexMenuData{Title: "投票の変更"}
+	label := ""
+	for _, p := range votePolicies {
+		data.Options = append(data.Options, flexMenuOption{Label: p.label, Text: ActionEventVotePolicy + " " + p.name})
+		if p.policy == current {
+			label = p.label
 		}
-		return linebot.NewTextMessage("参加イベント情報取得時にエラーが発生しました")
 	}
+	data.Text = "現在: " + label + "\n投票後に投票を変更できるかを選んでください"
+	return data
+}
 
-	return linebot.NewTemplateMessage(
-		"vote event",
-		linebot.NewButtonsTemplate(
-			"",
-			"投票",
-			"このイベントについて投票します",
-			linebot.NewMessageAction(voteString(domain.GREAT), fmt.Sprintf("voted %#v", domain.GREAT)),
-			linebot.NewMessageAction(voteString(domain.GOOD), fmt.Sprintf("voted %#v", domain.GOOD)),
-			linebot.NewMessageAction(voteString(domain.NOT_GOOD), fmt.Sprintf("voted %#v", domain.NOT_GOOD)),
-			linebot.NewMessageAction(voteString(domain.BAD), fmt.Sprintf("voted %#v", domain.BAD)),
-		),
-	)
+// getMessageSetVotePolicy 投票の変更可否の方針を変更するアクション
+func (s *Server) getMessageSetVotePolicy(ctx context.Context, uc *domain.UserContext, name string) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageSetVotePolicy")
+	if !uc.IsOrganizer() {
+		return linebot.NewTextMessage("あなたはまだイベントを主催していません")
+	}
+	for _, p := range votePolicies {
+		if p.name != name {
+			continue
+		}
+		if _, err := s.CallbackService.SetVotePolicy(ctx, domain.OwnerID(uc.UserID), p.policy); err != nil {
+			logError(ctx, err)
+			return linebot.NewTextMessage("投票の設定変更時にエラーが発生しました")
+		}
+		return linebot.NewTextMessage("投票の変更を「" + p.label + "」にしました")
+	}
+	setResult(ctx, resultRejected)
+	return linebot.NewTextMessage("指定された設定が見つかりません")
 }
 
-// getMessageOpenEvent イベント開催アクション
-func (s *Server) getMessageVoteEvent(ctx context.Context, req *linebot.Event, votes string) linebot.SendingMessage {
-	log.Println("called action.getMessageVoteEvent")
-	requestID := middleware.GetReqID(ctx)
-	userID := domain.UserID(req.Source.UserID)
+// getMessageEventStats 主催中のイベントの集計を返すアクション
+func (s *Server) getMessageEventStats(ctx context.Context, uc *domain.UserContext) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageEventStats")
+	if !uc.IsOrganizer() {
+		return linebot.NewTextMessage("あなたはまだイベントを主催していません")
+	}
+	analytics, err := s.AnalyticsService.GetEventAnalytics(ctx, uc.OwnedEvent.ID, 0)
+	if err != nil {
+		logError(ctx, err)
+		return linebot.NewTextMessage("集計時にエラーが発生しました")
+	}
+	data := flexStatsData{
+		Title:             eventTitle(uc.OwnedEvent),
+		Participants:      analytics.Participants,
+		PeakActive:        analytics.PeakActive,
+		Voters:            analytics.Voters,
+		ParticipationRate: fmt.Sprintf("%.0f%%", analytics.ParticipationRate*100),
+	}
+	lines := []string{
+		fmt.Sprintf("「%v」の集計", data.Title),
+		fmt.Sprintf("参加者: %v人 / 投票: %v人 (投票率 %v)", data.Participants, data.Voters, data.ParticipationRate),
+	}
+	if analytics.Voters > 0 {
+		data.MeanScore = fmt.Sprintf("%.2f", analytics.MeanScore)
+		data.NetScore = fmt.Sprintf("%+.0f", analytics.NetScore)
+		lines = append(lines, fmt.Sprintf("平均点: %v / ネットスコア: %v", data.MeanScore, data.NetScore))
+		for _, c := range analytics.Distribution {
+			data.Distribution = append(data.Distribution, flexVoteCount{
+				Label: voteString(c.Vote),
+				Count: c.Count,
+			})
+			lines = append(lines, fmt.Sprintf("%v: %v票", voteString(c.Vote), c.Count))
+		}
+	}
+	return s.flexMessage(ctx, flexStats, data, strings.Join(lines, "\n"))
+}
 
-	vote, err := strconv.Atoi(votes)
+// announceVoting は投票の受付開始をイベントの参加者にプッシュ通知します
+func (s *Server) announceVoting(ctx context.Context, event *domain.Event, minutes int) {
+	logger.FromContext(ctx).Debug("called action.announceVoting")
+	userIDs, err := s.CallbackService.GetParticipantIDs(ctx, event.ID)
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("参加イベント情報取得時にエラーが発生しました")
+		logError(ctx, err)
+		return
+	}
+	text := fmt.Sprintf("「%v」の投票が始まりました", eventTitle(event))
+	if minutes > 0 {
+		text += fmt.Sprintf("\n%v分後に締め切ります", minutes)
+	}
+	messages := []linebot.SendingMessage{s.voteTemplate(ctx, text)}
+	for start := 0; start < len(userIDs); start += multicastLimit {
+		end := start + multicastLimit
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+		to := make([]string, 0, end-start)
+		for _, userID := range userIDs[start:end] {
+			to = append(to, string(userID))
+		}
+		if _, err := s.Bot.Multicast(to, messages...).WithContext(ctx).Do(); err != nil {
+			logger.FromContext(ctx).Error("failed to announce voting", "error", err)
+		}
+	}
+}
+
+// getMessageInviteOrganizer 共同主催者の招待コードを発行するアクション
+func (s *Server) getMessageInviteOrganizer(ctx context.Context, uc *domain.UserContext) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageInviteOrganizer")
+	if !uc.IsOrganizer() {
+		return linebot.NewTextMessage("あなたはまだイベントを主催していません")
 	}
-	owned, err := s.isOwnerOfEvent(domain.OwnerID(userID))
+	invitation, err := s.CallbackService.IssueInvitation(ctx, uc.OwnedEvent.ID, domain.OwnerID(uc.UserID))
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("イベント参照時にエラーが発生しました")
+		logError(ctx, err)
+		return linebot.NewTextMessage("招待コード発行時にエラーが発生しました")
 	}
-	if owned {
+	msg := fmt.Sprintf("共同主催者の招待コード:\n%v\n共同主催者に「%v %v」と送信してもらいましょう", invitation.Code, ActionEventCoorganize, invitation.Code)
+	return linebot.NewTextMessage(msg)
+}
+
+// getMessageCoorganizeEvent 招待コードで共同主催者になるアクション
+func (s *Server) getMessageCoorganizeEvent(ctx context.Context, uc *domain.UserContext, code string) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageCoorganizeEvent")
+	ownerID := domain.OwnerID(uc.UserID)
+	if uc.IsOrganizer() {
 		return linebot.NewTextMessage("あなたが主催のイベントが開催中です")
 	}
-	user, err := s.CallbackService.GetParticipatedEvent(userID)
+	if uc.IsParticipating() {
+		logger.FromContext(ctx).Error("error in participated event", "event_id", uc.Participation.EventID)
+		setResult(ctx, resultConflict)
+		return linebot.NewTextMessage("あなたは既に別のイベントに参加しています")
+	}
+	invitation, err := s.CallbackService.GetInvitation(ctx, code)
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
 		if err == sql.ErrNoRows {
-			return linebot.NewTextMessage("あなたはまだイベントに参加していません")
+			return linebot.NewTextMessage("招待コードが正しくありません")
 		}
-		return linebot.NewTextMessage("参加イベント情報取得時にエラーが発生しました")
+		logError(ctx, err)
+		return linebot.NewTextMessage("招待コード照会時にエラーが発生しました")
 	}
-	status := domain.VOTE_STATUS(vote)
-	err = s.CallbackService.VoteEvent(ctx, &userID, &user.EventID, status)
+	event, err := s.CallbackService.GetEventByEventID(ctx, invitation.EventID)
 	if err != nil {
-		log.Printf("%v| error reason: %#v", requestID, err.Error())
-		return linebot.NewTextMessage("投票時にエラーが発生しました")
+		logError(ctx, err)
+		return linebot.NewTextMessage("開催イベント情報取得時にエラーが発生しました")
+	}
+	if event.Status != domain.EVENT_OPEN {
+		return linebot.NewTextMessage("このイベントはすでに終了しています")
+	}
+	if err = s.CallbackService.AddOrganizer(ctx, event.ID, ownerID); err != nil {
+		logError(ctx, err)
+		return linebot.NewTextMessage("共同主催者登録時にエラーが発生しました")
 	}
+	return linebot.NewTextMessage("共同主催者としてイベントに参加しました")
+}
 
-	return linebot.NewTextMessage(voteString(status) + "に投票しました")
+// getMessageOrganizerList 取り消し可能な共同主催者一覧を1ページ分返すアクション
+func (s *Server) getMessageOrganizerList(ctx context.Context, uc *domain.UserContext, page int) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageOrganizerList")
+	if uc.Role != domain.ROLE_OWNER {
+		return linebot.NewTextMessage("共同主催者の取り消しは主催者のみ行えます")
+	}
+	organizers, err := s.CallbackService.GetOrganizers(ctx, uc.OwnedEvent.ID)
+	if err != nil {
+		logError(ctx, err)
+		return linebot.NewTextMessage("共同主催者照会時にエラーが発生しました")
+	}
+	coOrganizers := []domain.Organizer{}
+	for _, organizer := range organizers {
+		if organizer.Role == domain.ORGANIZER_CO {
+			coOrganizers = append(coOrganizers, organizer)
+		}
+	}
+	if len(coOrganizers) < 1 {
+		return linebot.NewTextMessage("共同主催者はいません")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * organizerListPageSize
+	if start >= len(coOrganizers) {
+		return linebot.NewTextMessage("これ以上共同主催者はいません")
+	}
+	end := start + organizerListPageSize
+	hasNext := end < len(coOrganizers)
+	if !hasNext {
+		end = len(coOrganizers)
+	}
+
+	data := flexMenuData{
+		Title: "共同主催者",
+		Text:  "権限を取り消す共同主催者を選んでください",
+	}
+	for _, organizer := range coOrganizers[start:end] {
+		label := organizer.DisplayName
+		if label == "" {
+			label = string(organizer.OwnerID)
+		}
+		data.Options = append(data.Options, flexMenuOption{
+			Label: label,
+			Text:  ActionEventRevoke + " " + string(organizer.OwnerID),
+		})
+	}
+	if hasNext {
+		next := url.Values{}
+		next.Set("action", ActionEventRevoke)
+		next.Set("page", strconv.Itoa(page+1))
+		data.Options = append(data.Options, flexMenuOption{Label: "次へ", Data: next.Encode()})
+	}
+	return s.menuMessage(ctx, flexOrganizers, data)
+}
+
+// getMessageRevokeOrganizer 共同主催者の権限を取り消すアクション
+func (s *Server) getMessageRevokeOrganizer(ctx context.Context, uc *domain.UserContext, targetID domain.OwnerID) linebot.SendingMessage {
+	logger.FromContext(ctx).Debug("called action.getMessageRevokeOrganizer")
+	if uc.Role != domain.ROLE_OWNER {
+		return linebot.NewTextMessage("共同主催者の取り消しは主催者のみ行えます")
+	}
+	event := uc.OwnedEvent
+	organizer, err := s.CallbackService.GetOrganizer(ctx, event.ID, targetID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return linebot.NewTextMessage("指定されたユーザーは共同主催者ではありません")
+		}
+		logError(ctx, err)
+		return linebot.NewTextMessage("共同主催者照会時にエラーが発生しました")
+	}
+	if organizer.Role != domain.ORGANIZER_CO {
+		return linebot.NewTextMessage("主催者の権限は取り消せません")
+	}
+	if err = s.CallbackService.RevokeOrganizer(ctx, event.ID, targetID); err != nil {
+		logError(ctx, err)
+		return linebot.NewTextMessage("共同主催者取り消し時にエラーが発生しました")
+	}
+	return linebot.NewTextMessage("共同主催者の権限を取り消しました\n招待コードは無効になりました。再度招待する場合は新しいコードを発行してください")
 }
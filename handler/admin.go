@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/logger"
+)
+
+// 管理APIで指定できる推移の区間の秒数
+const (
+	minAnalyticsInterval = 60
+	maxAnalyticsInterval = 24 * 60 * 60
+)
+
+type voteCount struct {
+	Vote  int    `json:"vote"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+type timelineBucket struct {
+	Start     int     `json:"start"`
+	Joins     int     `json:"joins"`
+	Leaves    int     `json:"leaves"`
+	Active    int     `json:"active"`
+	Changes   int     `json:"changes"`
+	MeanScore float64 `json:"mean_score"`
+}
+
+type analytics struct {
+	EventID           string           `json:"event_id"`
+	Participants      int              `json:"participants"`
+	PeakActive        int              `json:"peak_active"`
+	Voters            int              `json:"voters"`
+	ParticipationRate float64          `json:"participation_rate"`
+	MeanScore         float64          `json:"mean_score"`
+	Distribution      []voteCount      `json:"distribution"`
+	NetScore          float64          `json:"net_score"`
+	Interval          int              `json:"interval"`
+	Timeline          []timelineBucket `json:"timeline"`
+}
+
+// adminAuth は管理APIをBearerトークンで保護します。トークンが設定されていない場合は管理APIを公開しない
+func (s *Server) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.AdminToken == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.AdminToken)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// eventAnalytics はイベントの集計をJSONで返します
+// interval で推移の区間の秒数を指定できます
+func (s *Server) eventAnalytics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.FromContext(ctx).Debug("called admin.eventAnalytics")
+	eventID := domain.EventID(chi.URLParam(r, "eventID"))
+
+	var interval time.Duration
+	if v := r.URL.Query().Get("interval"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minAnalyticsInterval || n > maxAnalyticsInterval {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		interval = time.Duration(n) * time.Second
+	}
+
+	ret, err := s.AnalyticsService.GetEventAnalytics(ctx, eventID, interval)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logError(ctx, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res := analytics{
+		EventID:           string(ret.EventID),
+		Participants:      ret.Participants,
+		PeakActive:        ret.PeakActive,
+		Voters:            ret.Voters,
+		ParticipationRate: ret.ParticipationRate,
+		MeanScore:         ret.MeanScore,
+		Distribution:      []voteCount{},
+		NetScore:          ret.NetScore,
+		Interval:          ret.Interval,
+		Timeline:          []timelineBucket{},
+	}
+	for _, c := range ret.Distribution {
+		res.Distribution = append(res.Distribution, voteCount{
+			Vote:  int(c.Vote),
+			Label: voteString(c.Vote),
+			Count: c.Count,
+		})
+	}
+	for _, b := range ret.Timeline {
+		res.Timeline = append(res.Timeline, timelineBucket(b))
+	}
+	rendering.JSON(w, http.StatusOK, res)
+}
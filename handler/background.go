@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mochisuna/linebot-sample/logger"
+)
+
+// jobs はリクエストの応答後も続く処理を管理し、終了時にその完了を待てるようにします
+type jobs struct {
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newJobs() *jobs {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobs{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// goBackground は fn を非同期に実行します
+// fn に渡される context は終了処理の期限を過ぎるとキャンセルされます
+func (s *Server) goBackground(fn func(context.Context)) {
+	s.jobs.wg.Add(1)
+	go func() {
+		defer s.jobs.wg.Done()
+		defer func() {
+			if p := recover(); p != nil {
+				logger.FromContext(s.jobs.ctx).Error("panic in background job", "panic", p)
+			}
+		}()
+		fn(s.jobs.ctx)
+	}()
+}
+
+// Shutdown は新しいリクエストの受付を止め、処理中のリクエストとバックグラウンド処理の完了を ctx の期限まで待ちます
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.Server.Shutdown(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		s.jobs.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.jobs.cancel()
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
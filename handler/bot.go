@@ -1,100 +1,284 @@
 package handler
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/line/line-bot-sdk-go/linebot"
 	"github.com/mochisuna/linebot-sample/config"
 	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/handler/flex"
+	"github.com/mochisuna/linebot-sample/logger"
+	"github.com/mochisuna/linebot-sample/metrics"
+	"github.com/mochisuna/linebot-sample/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
-	ActionEventOpen        = "open"
-	ActionEventClose       = "close"
-	ActionEventList        = "list"
-	ActionEventParticipate = "participate"
-	ActionEventLeave       = "leave"
-	ActionEventHelp        = "help"
-	ActionEventVote        = "vote"
-	ActionEventVoted       = "voted"
-	ActionEventStart       = "start"
-	ActionEventFinish      = "finish"
-	ActionEventCancel      = "cancel"
+	ActionEventOpen         = "open"
+	ActionEventClose        = "close"
+	ActionEventList         = "list"
+	ActionEventParticipate  = "participate"
+	ActionEventLeave        = "leave"
+	ActionEventHelp         = "help"
+	ActionEventVote         = "vote"
+	ActionEventVoted        = "voted"
+	ActionEventStart        = "start"
+	ActionEventStartPrivate = "start private"
+	ActionEventFinish       = "finish"
+	ActionEventCancel       = "cancel"
+	ActionEventInvite       = "invite"
+	ActionEventCoorganize   = "coorganize"
+	ActionEventRevoke       = "revoke"
+	ActionEventVoteOpen     = "vote open"
+	ActionEventVoteClose    = "vote close"
+	ActionEventVotePolicy   = "vote policy"
+	ActionEventStats        = "stats"
+	ActionEventComment      = "comment"
 )
 
 // TODO ファイルから読み出すように変更
 const HelpMessage = "このbotについて\nこのbotはLT会等で、参加者からアンケートを募集することを目的に作られています。\n\n以下のアクション一覧から利用したいコマンドを実行してください。"
 
 type Line struct {
-	Bot *linebot.Client
+	Bot       *linebot.Client
+	BasicID   string
+	Templates *flex.Templates
 }
 
 // New inject to domain services
-func NewLineBot(config *config.Line) *Line {
-	client, err := linebot.New(config.ChannelSecret, config.ChannelToken)
+func NewLineBot(config *config.Line, templates *flex.Templates) *Line {
+	// LINE APIの呼び出し時間とステータスコードを記録する
+	httpClient := &http.Client{
+		Transport: tracing.NewTransport(metrics.NewLineTransport(http.DefaultTransport), func(r *http.Request) string {
+			return metrics.Endpoint(r.URL.Path)
+		}),
+	}
+	client, err := linebot.New(config.ChannelSecret, config.ChannelToken, linebot.WithHTTPClient(httpClient))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	return &Line{client}
+	return &Line{
+		Bot:       client,
+		BasicID:   config.BasicID,
+		Templates: templates,
+	}
 }
 
 func (s *Server) callback(w http.ResponseWriter, r *http.Request) {
-	log.Println("callback")
-	ctx := r.Context()
+	logger.FromContext(r.Context()).Debug("callback")
 	reqests, err := s.Bot.ParseRequest(r)
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("invalid callback request", "error", err)
+	}
 	for _, req := range reqests {
-		fmt.Printf("%#v\n", req)
-		var response linebot.SendingMessage
-		switch req.Type {
-		case linebot.EventTypeMessage:
-			switch message := req.Message.(type) {
-			case *linebot.TextMessage:
-				switch message.Text {
-				// リッチメニューボタン
-				case ActionEventOpen:
-					response = s.getMessageOpenEvent(ctx, req)
-				case ActionEventClose:
-					response = s.getMessageCloseEvent(ctx, req)
-				case ActionEventList:
-					response = s.getMessageEvents(ctx, req)
-				case ActionEventVote:
-					response = s.getMessageVoteList(ctx, req)
-				case ActionEventLeave:
-					response = s.getMessageLeaveEvent(ctx, req)
-				case ActionEventHelp:
-					response = linebot.NewTextMessage(HelpMessage)
-				// 確認処理ボタン
-				case ActionEventStart:
-					response = s.getMessageStartEvent(ctx, req)
-				case ActionEventFinish:
-					response = s.getMessageFinishEvent(ctx, req)
-				case ActionEventCancel:
-					response = linebot.NewTextMessage("処理を中断しました")
-				default:
-					if strings.Contains(message.Text, ActionEventParticipate) {
-						splits := strings.Split(message.Text, " ")
-						log.Println(message.Text)
-						eventID := domain.EventID(splits[1])
-						response = s.getMessageParticipateEvent(ctx, req, eventID)
-					} else if strings.Contains(message.Text, ActionEventVoted) {
-						splits := strings.Split(message.Text, " ")
-						response = s.getMessageVoteEvent(ctx, req, splits[1])
-					} else {
-						response = linebot.NewTextMessage(message.Text)
+		s.handleEvent(r.Context(), req)
+	}
+}
+
+// handleEvent はwebhookイベント1件を処理して返信します
+func (s *Server) handleEvent(ctx context.Context, req *linebot.Event) {
+	command := commandOf(req)
+	ctx, span := tracing.Start(ctx, "Server.callback",
+		attribute.String("linebot.event_type", string(req.Type)),
+		attribute.String("linebot.command", command),
+	)
+	defer span.End()
+	// 書き込み直後の読み込みをマスターへ向けるためにユーザーを紐付けておく
+	ctx = repository.WithActor(ctx, req.Source.UserID)
+	ctx = logger.With(ctx,
+		"user", logger.HashUserID(req.Source.UserID),
+		"event_type", string(req.Type),
+		"command", command,
+	)
+	if sc := span.SpanContext(); sc.IsValid() {
+		ctx = logger.With(ctx, "trace_id", sc.TraceID().String())
+	}
+	logger.FromContext(ctx).Debug("received event")
+	metrics.WebhookEvents.WithLabelValues(string(req.Type), command).Inc()
+	ctx, result := withCommandResult(ctx)
+	start := time.Now()
+	var responses []linebot.SendingMessage
+	if !s.allow(ctx, req, command) {
+		setResult(ctx, resultRateLimited)
+		responses = []linebot.SendingMessage{linebot.NewTextMessage(rateLimitedMessage)}
+	} else if uc, err := s.resolveUserContext(ctx, req, command); err != nil {
+		logError(ctx, err)
+		responses = []linebot.SendingMessage{linebot.NewTextMessage("ユーザー情報取得時にエラーが発生しました")}
+	} else {
+		responses = s.dispatch(ctx, req, uc)
+	}
+
+	observeCommand(command, result, start)
+	span.SetAttributes(attribute.String("linebot.result", result.result))
+
+	// 全処理をここで一括
+	if len(responses) < 1 {
+		return
+	}
+	if _, err := s.Bot.ReplyMessage(req.ReplyToken, responses...).WithContext(ctx).Do(); err != nil {
+		logger.FromContext(ctx).Error("failed to reply", "error", err)
+		span.RecordError(err)
+	}
+}
+
+// resolveUserContext はユーザーの状態が必要なコマンドの場合に一度だけ取得します
+func (s *Server) resolveUserContext(ctx context.Context, req *linebot.Event, command string) (*domain.UserContext, error) {
+	switch command {
+	case ActionEventHelp, ActionEventCancel:
+		return nil, nil
+	}
+	if req.Type != linebot.EventTypeMessage && req.Type != linebot.EventTypePostback {
+		return nil, nil
+	}
+	return s.CallbackService.GetUserContext(ctx, domain.UserID(req.Source.UserID))
+}
+
+// dispatch はコマンドに応じたアクションを実行して返信するメッセージを返します
+func (s *Server) dispatch(ctx context.Context, req *linebot.Event, uc *domain.UserContext) []linebot.SendingMessage {
+	var response linebot.SendingMessage
+	var responses []linebot.SendingMessage
+	switch req.Type {
+	case linebot.EventTypeMessage:
+		switch message := req.Message.(type) {
+		case *linebot.TextMessage:
+			switch message.Text {
+			// リッチメニューボタン
+			case ActionEventOpen:
+				response = s.getMessageOpenEvent(ctx, uc, "")
+			case ActionEventClose:
+				response = s.getMessageCloseEvent(ctx, uc)
+			case ActionEventList:
+				response = s.getMessageEvents(ctx, uc, 1)
+			case ActionEventVote:
+				response = s.getMessageVoteList(ctx, uc)
+			case ActionEventLeave:
+				response = s.getMessageLeaveEvent(ctx, uc)
+			case ActionEventHelp:
+				response = linebot.NewTextMessage(HelpMessage)
+			// 共同主催者
+			case ActionEventInvite:
+				response = s.getMessageInviteOrganizer(ctx, uc)
+			case ActionEventRevoke:
+				response = s.getMessageOrganizerList(ctx, uc, 1)
+			// 確認処理ボタン
+			case ActionEventStart:
+				responses = s.getMessagesStartEvent(ctx, uc, false)
+			case ActionEventStartPrivate:
+				responses = s.getMessagesStartEvent(ctx, uc, true)
+			case ActionEventFinish:
+				response = s.getMessageFinishEvent(ctx, uc)
+			// 投票の受付
+			case ActionEventVoteOpen:
+				response = s.getMessageOpenVoting(ctx, uc, "")
+			case ActionEventVoteClose:
+				response = s.getMessageCloseVoting(ctx, uc)
+			case ActionEventVotePolicy:
+				response = s.getMessageVotePolicyList(ctx, uc)
+			case ActionEventStats:
+				response = s.getMessageEventStats(ctx, uc)
+			case ActionEventCancel:
+				response = linebot.NewTextMessage("処理を中断しました")
+			default:
+				// 本文に他のコマンド名を含むことがあるので最初に判定する
+				if splits := strings.SplitN(message.Text, " ", 2); len(splits) > 1 && splits[0] == ActionEventComment {
+					response = s.getMessagePostComment(ctx, uc, strings.TrimSpace(splits[1]))
+				} else if splits := strings.Fields(message.Text); len(splits) > 1 && splits[0] == ActionEventParticipate {
+					passcode := ""
+					if len(splits) > 2 {
+						passcode = splits[2]
 					}
+					response = s.getMessageParticipateEvent(ctx, uc, splits[1], passcode)
+				} else if splits := strings.Fields(message.Text); len(splits) > 1 && splits[0] == ActionEventVoted {
+					response = s.getMessageVoteEvent(ctx, uc, splits[1])
+				} else if splits := strings.Fields(message.Text); len(splits) > 2 && splits[0]+" "+splits[1] == ActionEventVoteOpen {
+					response = s.getMessageOpenVoting(ctx, uc, splits[2])
+				} else if splits := strings.Fields(message.Text); len(splits) > 2 && splits[0]+" "+splits[1] == ActionEventVotePolicy {
+					response = s.getMessageSetVotePolicy(ctx, uc, splits[2])
+				} else if splits := strings.SplitN(message.Text, " ", 2); len(splits) > 1 && splits[0] == ActionEventOpen {
+					response = s.getMessageOpenEvent(ctx, uc, strings.TrimSpace(splits[1]))
+				} else if splits := strings.Fields(message.Text); len(splits) > 1 && splits[0] == ActionEventCoorganize {
+					response = s.getMessageCoorganizeEvent(ctx, uc, strings.ToUpper(splits[1]))
+				} else if splits := strings.Fields(message.Text); len(splits) > 1 && splits[0] == ActionEventRevoke {
+					response = s.getMessageRevokeOrganizer(ctx, uc, domain.OwnerID(splits[1]))
+				} else {
+					response = linebot.NewTextMessage(message.Text)
 				}
 			}
-		case linebot.EventTypeFollow:
-			response = s.getMessageFollowAction(ctx, req)
 		}
+	case linebot.EventTypePostback:
+		data, err := url.ParseQuery(req.Postback.Data)
+		if err != nil {
+			logger.FromContext(ctx).Warn("invalid postback data", "error", err)
+			setResult(ctx, resultRejected)
+			return nil
+		}
+		switch data.Get("action") {
+		case ActionEventList:
+			page, _ := strconv.Atoi(data.Get("page"))
+			response = s.getMessageEvents(ctx, uc, page)
+		case ActionEventRevoke:
+			page, _ := strconv.Atoi(data.Get("page"))
+			response = s.getMessageOrganizerList(ctx, uc, page)
+		}
+	case linebot.EventTypeFollow:
+		response = s.getMessageFollowAction(ctx, req)
+	}
+
+	if response != nil {
+		responses = append(responses, response)
+	}
+	return responses
+}
 
-		// 全処理をここで一括
-		if _, err = s.Bot.ReplyMessage(req.ReplyToken, response).Do(); err != nil {
-			fmt.Println(err)
+// commandUnknown は既知のアクションでない postback のコマンド名
+const commandUnknown = "unknown"
+
+// commandOf はログに出すコマンド名を返します。本文はログに出さないため既知のコマンドのみを返します
+func commandOf(req *linebot.Event) string {
+	switch req.Type {
+	case linebot.EventTypeMessage:
+		message, ok := req.Message.(*linebot.TextMessage)
+		if !ok {
+			return ""
+		}
+		if message.Text == ActionEventStartPrivate {
+			return message.Text
+		}
+		fields := strings.Fields(message.Text)
+		if len(fields) < 1 {
+			return ""
+		}
+		if len(fields) > 1 {
+			if command := fields[0] + " " + fields[1]; command == ActionEventVoteOpen || command == ActionEventVoteClose || command == ActionEventVotePolicy {
+				return command
+			}
+		}
+		switch fields[0] {
+		case ActionEventOpen, ActionEventClose, ActionEventList, ActionEventParticipate, ActionEventLeave,
+			ActionEventHelp, ActionEventVote, ActionEventVoted, ActionEventStart, ActionEventFinish,
+			ActionEventCancel, ActionEventInvite, ActionEventCoorganize, ActionEventRevoke, ActionEventStats,
+			ActionEventComment:
+			return fields[0]
+		}
+	case linebot.EventTypePostback:
+		// postback のデータは利用者が書き換えられるため、既知のアクション以外はまとめる
+		data, err := url.ParseQuery(req.Postback.Data)
+		if err != nil {
+			return commandUnknown
+		}
+		switch action := data.Get("action"); action {
+		case ActionEventList, ActionEventRevoke:
+			return action
 		}
+		return commandUnknown
 	}
+	return ""
 }
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mochisuna/linebot-sample/domain"
+)
+
+func textEvent(text string) *linebot.Event {
+	return &linebot.Event{
+		Type:    linebot.EventTypeMessage,
+		Message: linebot.NewTextMessage(text),
+	}
+}
+
+func TestCommandOf(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"participate 123456", ActionEventParticipate},
+		{"participate", ActionEventParticipate},
+		{"I will participate", ""},
+		{"voted 1", ActionEventVoted},
+		{"vote open 10", ActionEventVoteOpen},
+		{"vote policy lock", ActionEventVotePolicy},
+		{"start private", ActionEventStartPrivate},
+		{"comment participate later", ActionEventComment},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := commandOf(textEvent(tt.text)); got != tt.want {
+			t.Errorf("commandOf(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCommandOfPostback(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"action=list&page=2", ActionEventList},
+		{"action=revoke&page=2", ActionEventRevoke},
+		{"action=participate", commandUnknown},
+		{"action=" + strings.Repeat("x", 100), commandUnknown},
+		{"page=2", commandUnknown},
+		{"%zz", commandUnknown},
+	}
+	for _, tt := range tests {
+		req := &linebot.Event{Type: linebot.EventTypePostback, Postback: &linebot.Postback{Data: tt.data}}
+		if got := commandOf(req); got != tt.want {
+			t.Errorf("commandOf(postback %q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+// TestDispatchIncompleteCommands はコマンド名だけの入力や本文中のコマンド名でアクションが呼ばれないことを確認します
+// サービスを持たない Server でアクションに進むと panic する
+func TestDispatchIncompleteCommands(t *testing.T) {
+	s := &Server{}
+	uc := &domain.UserContext{UserID: "U1"}
+	for _, text := range []string{"participate", "voted", "I will participate", "I voted yesterday", "participate "} {
+		responses := s.dispatch(context.Background(), textEvent(text), uc)
+		if len(responses) != 1 {
+			t.Fatalf("dispatch(%q) returned %v messages, want 1", text, len(responses))
+		}
+		message, ok := responses[0].(*linebot.TextMessage)
+		if !ok || message.Text != text {
+			t.Errorf("dispatch(%q) = %#v, want echo", text, responses[0])
+		}
+	}
+}
+
+// TestDispatchInvalidVote は数字でない投票をサービスを呼ばずに案内することを確認します
+func TestDispatchInvalidVote(t *testing.T) {
+	s := &Server{}
+	uc := &domain.UserContext{UserID: "U1"}
+	for _, text := range []string{"voted great", "voted 1.5"} {
+		responses := s.dispatch(context.Background(), textEvent(text), uc)
+		if len(responses) != 1 {
+			t.Fatalf("dispatch(%q) returned %v messages, want 1", text, len(responses))
+		}
+		message, ok := responses[0].(*linebot.TextMessage)
+		if !ok || !strings.HasPrefix(message.Text, "投票は1〜4の数字で送信してください") {
+			t.Errorf("dispatch(%q) = %#v, want invalid vote message", text, responses[0])
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/handler/flex"
+)
+
+// Flex Message のテンプレート名。_tools/flex/<名前>.json に対応する
+const (
+	flexVote       = "vote"
+	flexEvents     = "events"
+	flexStats      = "stats"
+	flexFinish     = "finish"
+	flexOpen       = "open"
+	flexStarted    = "started"
+	flexVoting     = "voting"
+	flexVotePolicy = "vote_policy"
+	flexOrganizers = "organizers"
+)
+
+// flexVoteData は投票ボタンのテンプレートに渡すデータ
+type flexVoteData struct {
+	Text    string
+	Options []flexVoteOption
+}
+
+type flexVoteOption struct {
+	Label string
+	Text  string // 押したときに送信されるメッセージ
+}
+
+// flexEventsData はイベント一覧のテンプレートに渡すデータ
+type flexEventsData struct {
+	Events []flexEvent
+	// Next は次のページを表示するポストバックのデータ。最後のページの場合は空
+	Next string
+}
+
+type flexEvent struct {
+	Title        string
+	Owner        string
+	Participants int
+	Text         string // 参加ボタンで送信されるメッセージ
+}
+
+// flexStatsData は集計のテンプレートに渡すデータ
+type flexStatsData struct {
+	Title             string
+	Participants      int
+	PeakActive        int
+	Voters            int
+	ParticipationRate string
+	MeanScore         string // 投票がない場合は空
+	NetScore          string
+	Distribution      []flexVoteCount
+}
+
+type flexVoteCount struct {
+	Label string
+	Count int
+}
+
+// flexFinishData はイベント終了のテンプレートに渡すデータ
+type flexFinishData struct {
+	Title     string
+	ReportURL string // レポートを発行しない場合は空
+	Expires   string
+}
+
+// flexMenuData はボタンを並べるテンプレート (open, vote_policy, organizers) に渡すデータ
+type flexMenuData struct {
+	Title   string
+	Text    string
+	Options []flexMenuOption
+}
+
+type flexMenuOption struct {
+	Label string
+	Text  string // 押したときに送信されるメッセージ
+	Data  string // ポストバックのデータ。空でない場合はメッセージの代わりにポストバックを送る
+}
+
+// flexStartedData はイベント開催のテンプレートに渡すデータ
+type flexStartedData struct {
+	Title    string
+	JoinCode string
+	EventID  string
+	Passcode string // 公開イベントの場合は空
+	Command  string // 参加者に送信してもらうメッセージ
+	ShareURL string // 参加方法を友だちに送るためのURL
+}
+
+// flexVotingData は投票の受付状況のテンプレートに渡すデータ
+type flexVotingData struct {
+	Title    string
+	Text     string
+	ClosesAt string // 締め切りがない場合は空
+}
+
+// flexSamples は起動時の検証と -render で使うテンプレートごとのデータ
+var flexSamples = map[string]interface{}{
+	flexVote: newFlexVoteData("このイベントについて投票します"),
+	flexEvents: flexEventsData{
+		Events: []flexEvent{
+			{Title: "LT会", Owner: "mochisuna", Participants: 12, Text: ActionEventParticipate + " 123456"},
+		},
+		Next: "action=list&page=2",
+	},
+	flexStats: flexStatsData{
+		Title:             "LT会",
+		Participants:      12,
+		PeakActive:        10,
+		Voters:            9,
+		ParticipationRate: "75%",
+		MeanScore:         "3.11",
+		NetScore:          "+22",
+		Distribution: []flexVoteCount{
+			{Label: voteString(domain.GREAT), Count: 4},
+			{Label: voteString(domain.GOOD), Count: 3},
+			{Label: voteString(domain.NOT_GOOD), Count: 1},
+			{Label: voteString(domain.BAD), Count: 1},
+		},
+	},
+	flexFinish: flexFinishData{
+		Title:     "LT会",
+		ReportURL: "https://example.com/v1/events/sample/report?expires=0&sig=sample",
+		Expires:   "2006/01/02 15:04",
+	},
+	flexOpen: newOpenMenu(),
+	flexStarted: flexStartedData{
+		Title:    "LT会",
+		JoinCode: "123456",
+		EventID:  "sample",
+		Passcode: "1234",
+		Command:  ActionEventParticipate + " 123456 1234",
+		ShareURL: lineShareURL("「LT会」には「" + ActionEventParticipate + " 123456 1234」と送信して参加してください"),
+	},
+	flexVoting: flexVotingData{
+		Title:    "LT会",
+		Text:     "投票の受付を開始しました",
+		ClosesAt: "2006/01/02 15:04",
+	},
+	flexVotePolicy: newVotePolicyMenu(domain.VOTE_POLICY_CHANGEABLE),
+	flexOrganizers: flexMenuData{
+		Title: "共同主催者",
+		Text:  "権限を取り消す共同主催者を選んでください",
+		Options: []flexMenuOption{
+			{Label: "mochisuna", Text: ActionEventRevoke + " Uxxxxxxxx"},
+			{Label: "次へ", Data: "action=revoke&page=2"},
+		},
+	},
+}
+
+// ValidateFlex はbotが使うテンプレートが全て揃っていて、展開できるかを確認します
+func ValidateFlex(templates *flex.Templates) error {
+	return templates.Validate(flexSamples)
+}
+
+// RenderFlex はテンプレートを展開して送信するメッセージのJSONを返します。テンプレートの確認用
+// data が空の場合はサンプルのデータを使い、指定された場合はサンプルと同じ型として読み込みます
+func RenderFlex(templates *flex.Templates, name string, data []byte) ([]byte, error) {
+	sample, ok := flexSamples[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown flex template %v", name)
+	}
+	if len(data) > 0 {
+		v := reflect.New(reflect.TypeOf(sample))
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(v.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid data for flex template %v: %v", name, err)
+		}
+		sample = v.Elem().Interface()
+	}
+	message, err := templates.Render(name, sample)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(message, "", "  ")
+}
+
+// flexMessage はテンプレートからメッセージを作ります。展開に失敗した場合は fallback をテキストで返す
+func (s *Server) flexMessage(ctx context.Context, name string, data interface{}, fallback string) linebot.SendingMessage {
+	message, err := s.Templates.Render(name, data)
+	if err != nil {
+		logError(ctx, err)
+		return linebot.NewTextMessage(fallback)
+	}
+	return message
+}
+
+// menuMessage はボタンを並べたメッセージを返します。展開に失敗した場合はボタンで送信される内容をテキストで並べる
+func (s *Server) menuMessage(ctx context.Context, name string, data flexMenuData) linebot.SendingMessage {
+	lines := []string{data.Text}
+	for _, option := range data.Options {
+		if option.Data == "" {
+			lines = append(lines, fmt.Sprintf("%v: %v", option.Label, option.Text))
+		}
+	}
+	return s.flexMessage(ctx, name, data, strings.Join(lines, "\n"))
+}
+
+func newFlexVoteData(text string) flexVoteData {
+	data := flexVoteData{Text: text}
+	for _, vote := range []domain.VOTE_STATUS{domain.GREAT, domain.GOOD, domain.NOT_GOOD, domain.BAD} {
+		data.Options = append(data.Options, flexVoteOption{
+			Label: voteString(vote),
+			Text:  fmt.Sprintf("%v %#v", ActionEventVoted, vote),
+		})
+	}
+	return data
+}
@@ -0,0 +1,130 @@
+package flex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// DefaultDir はテンプレートのディレクトリが指定されていない場合に使うディレクトリ
+const DefaultDir = "_tools/flex"
+
+// altTextMaxLength はLINEの代替テキストの最大文字数
+const altTextMaxLength = 400
+
+// テンプレート内で使える関数
+// 値は必ず json を通して埋め込み、ユーザーの入力でJSONが壊れないようにする
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"truncate": func(max int, str string) string {
+		if runes := []rune(str); len(runes) > max {
+			return string(runes[:max])
+		}
+		return str
+	},
+}
+
+// document はテンプレートを展開した後のJSONの形
+// contents にはLINEの Flex Message のコンテナ (bubble または carousel) を書く
+type document struct {
+	AltText  string          `json:"altText"`
+	Contents json.RawMessage `json:"contents"`
+}
+
+// Templates はディレクトリから読み込んだ Flex Message のテンプレート
+type Templates struct {
+	dir       string
+	templates map[string]*template.Template
+}
+
+// Load は dir 内の *.json をテンプレートとして読み込みます。ファイル名から拡張子を除いたものがテンプレート名になる
+func Load(dir string) (*Templates, error) {
+	if dir == "" {
+		dir = DefaultDir
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no flex templates in %v", dir)
+	}
+	t := &Templates{
+		dir:       dir,
+		templates: map[string]*template.Template{},
+	}
+	for _, path := range paths {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse flex template %v: %v", path, err)
+		}
+		t.templates[name] = tmpl
+	}
+	return t, nil
+}
+
+// Validate は samples のテンプレートが全て揃っていて、サンプルのデータで Flex Message として展開できるかを確認します
+// 問題は全てまとめて返す
+func (t *Templates) Validate(samples map[string]interface{}) error {
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var problems []string
+	for _, name := range names {
+		if _, err := t.Render(name, samples[name]); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid flex templates in %v:\n  %v", t.dir, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Render はテンプレートを data で展開して Flex Message を返します
+// SDKが対応していないプロパティは送信時に落ちるため、実際に送る内容は -render で確認する
+func (t *Templates) Render(name string, data interface{}) (*linebot.FlexMessage, error) {
+	tmpl, ok := t.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("flex template %v: not found", name)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("flex template %v: %v", name, err)
+	}
+	var doc document
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		return nil, fmt.Errorf("flex template %v: rendered invalid json: %v", name, err)
+	}
+	if doc.AltText == "" {
+		return nil, fmt.Errorf("flex template %v: altText is required", name)
+	}
+	if len([]rune(doc.AltText)) > altTextMaxLength {
+		return nil, fmt.Errorf("flex template %v: altText must be at most %v characters", name, altTextMaxLength)
+	}
+	contents, err := linebot.UnmarshalFlexMessageJSON(doc.Contents)
+	if err != nil {
+		return nil, fmt.Errorf("flex template %v: invalid contents: %v", name, err)
+	}
+	if contents == nil {
+		return nil, fmt.Errorf("flex template %v: contents must be a bubble or carousel", name)
+	}
+	return linebot.NewFlexMessage(doc.AltText, contents), nil
+}
@@ -0,0 +1,121 @@
+package flex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplates は name.json にテンプレートを書き出したディレクトリを返します
+func writeTemplates(t *testing.T, templates map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range templates {
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const bubble = `{"type": "bubble", "body": {"type": "box", "layout": "vertical", "contents": [{"type": "text", "text": {{json .Text}}}]}}`
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]string
+		wantErr   string
+	}{
+		{"empty directory", nil, "no flex templates"},
+		{"parse error", map[string]string{"broken": `{{if .Text}}`}, "failed to parse flex template"},
+		{"ok", map[string]string{"a": `{"altText": "a", "contents": ` + bubble + `}`}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeTemplates(t, tt.templates))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	templates, err := Load(writeTemplates(t, map[string]string{
+		"ok":        `{"altText": {{.Text | truncate 5 | json}}, "contents": ` + bubble + `}`,
+		"noalt":     `{"altText": "", "contents": ` + bubble + `}`,
+		"longalt":   `{"altText": {{json .Text}}, "contents": ` + bubble + `}`,
+		"broken":    `{"altText": "a", "contents": {{.Text}}}`,
+		"nobubble":  `{"altText": "a", "contents": {"type": "box"}}`,
+		"missing":   `{"altText": {{json .Missing}}, "contents": ` + bubble + `}`,
+		"undefined": `{"altText": "a", "contents": {"type": "unknown"}}`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type data struct{ Text string }
+	tests := []struct {
+		name    string
+		data    interface{}
+		wantAlt string
+		wantErr string
+	}{
+		// ユーザーの入力に引用符や改行があってもJSONが壊れない
+		{"ok", data{"\"引\"\n改行"}, "\"引\"\n改", ""},
+		{"not found", data{}, "", "not found"},
+		{"noalt", data{"a"}, "", "altText is required"},
+		{"longalt", data{strings.Repeat("あ", altTextMaxLength+1)}, "", "at most"},
+		{"broken", data{"{"}, "", "rendered invalid json"},
+		{"nobubble", data{}, "", "contents"},
+		{"missing", map[string]string{}, "", "flex template missing"},
+		{"undefined", data{}, "", "contents"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := templates.Render(tt.name, tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Render() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message.AltText != tt.wantAlt {
+				t.Errorf("AltText = %q, want %q", message.AltText, tt.wantAlt)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	templates, err := Load(writeTemplates(t, map[string]string{
+		"ok":    `{"altText": "a", "contents": ` + bubble + `}`,
+		"noalt": `{"altText": "", "contents": ` + bubble + `}`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := struct{ Text string }{"a"}
+	if err := templates.Validate(map[string]interface{}{"ok": sample}); err != nil {
+		t.Errorf("Validate(ok) error = %v", err)
+	}
+	// 問題はまとめて返す
+	err = templates.Validate(map[string]interface{}{"ok": sample, "noalt": sample, "absent": sample})
+	if err == nil {
+		t.Fatal("Validate() succeeded, want error")
+	}
+	for _, want := range []string{"noalt", "absent"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want it to mention %v", err, want)
+		}
+	}
+}
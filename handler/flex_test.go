@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mochisuna/linebot-sample/handler/flex"
+)
+
+// loadFlex はリポジトリの _tools/flex のテンプレートを読み込みます
+func loadFlex(t *testing.T) *flex.Templates {
+	t.Helper()
+	templates, err := flex.Load(filepath.Join("..", flex.DefaultDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+func TestValidateFlex(t *testing.T) {
+	if err := ValidateFlex(loadFlex(t)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenderFlex(t *testing.T) {
+	templates := loadFlex(t)
+	tests := []struct {
+		name     string
+		template string
+		data     string
+		want     []string // 展開結果に含まれる文字列
+		wantErr  string
+	}{
+		{name: "sample", template: flexOpen, want: []string{`"altText"`, ActionEventStartPrivate}},
+		{name: "data", template: flexVoting, data: `{"Title": "勉強会", "Text": "投票の受付を締め切りました"}`, want: []string{"勉強会"}},
+		{name: "postback", template: flexOrganizers, data: `{"Text": "選んでください", "Options": [{"Label": "次へ", "Data": "action=revoke&page=3"}]}`, want: []string{`"postback"`, "page=3"}},
+		{name: "unknown template", template: "unknown", wantErr: "unknown flex template"},
+		{name: "unknown field", template: flexVoting, data: `{"Titel": "typo"}`, wantErr: "invalid data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data []byte
+			if tt.data != "" {
+				data = []byte(tt.data)
+			}
+			got, err := RenderFlex(templates, tt.template, data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("RenderFlex() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !json.Valid(got) {
+				t.Fatalf("RenderFlex() = %s, want json", got)
+			}
+			// json.MarshalIndent は & をエスケープする
+			text := strings.ReplaceAll(string(got), `\u0026`, "&")
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("RenderFlex() = %s, want it to contain %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestMenuMessageFallback はテンプレートを展開できない場合にボタンの送信内容をテキストで返すことを確認します
+func TestMenuMessageFallback(t *testing.T) {
+	s := &Server{Line: &Line{Templates: loadFlex(t)}}
+	data := newVotePolicyMenu(0)
+	data.Options = append(data.Options, flexMenuOption{Label: "次へ", Data: "action=revoke&page=2"})
+
+	if _, ok := s.menuMessage(context.Background(), flexVotePolicy, data).(*linebot.FlexMessage); !ok {
+		t.Fatal("menuMessage() did not render the template")
+	}
+	message, ok := s.menuMessage(context.Background(), "missing", data).(*linebot.TextMessage)
+	if !ok {
+		t.Fatal("menuMessage() with a missing template did not fall back to text")
+	}
+	for _, p := range votePolicies {
+		if !strings.Contains(message.Text, ActionEventVotePolicy+" "+p.name) {
+			t.Errorf("fallback %q does not contain the %v command", message.Text, p.name)
+		}
+	}
+	if strings.Contains(message.Text, "次へ") {
+		t.Errorf("fallback %q contains a postback option", message.Text)
+	}
+}
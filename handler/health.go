@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 準備状態確認でDBごとに待つ時間
+const readinessTimeout = 2 * time.Second
+
+// DBChecker は準備状態の確認対象となるDB接続
+type DBChecker interface {
+	PingContext(ctx context.Context) error
+	Stats() sql.DBStats
+	ReplicaLag(ctx context.Context) (*int, error)
+}
+
+type poolStatus struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+}
+
+type dbStatus struct {
+	OK                bool       `json:"ok"`
+	Error             string     `json:"error,omitempty"`
+	LatencyMS         int64      `json:"latency_ms"`
+	ReplicaLagSeconds *int       `json:"replica_lag_seconds,omitempty"`
+	ReplicaLagError   string     `json:"replica_lag_error,omitempty"`
+	Pool              poolStatus `json:"pool"`
+}
+
+type readiness struct {
+	Ready     bool                `json:"ready"`
+	Databases map[string]dbStatus `json:"databases"`
+}
+
+// live はプロセスが応答できることだけを返します
+func (s *Server) live(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// ready は全DBへの疎通を確認し、レプリカ遅延とコネクションプールの状態をJSONで返します
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	ret := readiness{
+		Ready:     true,
+		Databases: map[string]dbStatus{},
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, checker := range s.Databases {
+		wg.Add(1)
+		go func(name string, checker DBChecker) {
+			defer wg.Done()
+			status := checkDB(r.Context(), checker)
+			mu.Lock()
+			defer mu.Unlock()
+			ret.Databases[name] = status
+			if !status.OK {
+				ret.Ready = false
+			}
+		}(name, checker)
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	if !ret.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	rendering.JSON(w, code, ret)
+}
+
+func checkDB(ctx context.Context, checker DBChecker) dbStatus {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	var status dbStatus
+	start := time.Now()
+	err := checker.PingContext(ctx)
+	status.LatencyMS = time.Since(start).Nanoseconds() / int64(time.Millisecond)
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.OK = true
+		// 遅延が取得できないのは権限不足の場合もあるので準備状態には含めない
+		if lag, err := checker.ReplicaLag(ctx); err != nil {
+			status.ReplicaLagError = err.Error()
+		} else {
+			status.ReplicaLagSeconds = lag
+		}
+	}
+
+	stats := checker.Stats()
+	status.Pool = poolStatus{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration.String(),
+	}
+	return status
+}
@@ -2,9 +2,12 @@ package handler
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/mochisuna/linebot-sample/config"
 	"github.com/mochisuna/linebot-sample/domain/service"
+	"github.com/mochisuna/linebot-sample/metrics"
 	"github.com/unrolled/render"
 	validator "gopkg.in/go-playground/validator.v9"
 
@@ -18,7 +21,10 @@ var validate = validator.New()
 
 // Services is grouping application services structure
 type Services struct {
-	CallbackService service.CallbackService
+	CallbackService  service.CallbackService
+	StatsService     service.StatsService
+	AnalyticsService service.AnalyticsService
+	ReportService    service.ReportService
 }
 
 // Server HTTP server
@@ -26,16 +32,35 @@ type Server struct {
 	*http.Server
 	*Services
 	*Line
+	BaseURL    string
+	AdminToken string
+	// ReportSecret はレポートURLの署名の鍵
+	ReportSecret string
+	ReportTTL    time.Duration
+	Databases    map[string]DBChecker
+	Limiter      RateLimiter
+	jobs         *jobs
 }
 
 // New inject to domain services
-func New(addr string, services *Services, line *Line) *Server {
+func New(conf *config.Server, reportConf *config.Report, services *Services, line *Line, databases map[string]DBChecker, limiter RateLimiter) *Server {
+	reportTTL := defaultReportTTL
+	if reportConf.TTLHours > 0 {
+		reportTTL = time.Duration(reportConf.TTLHours) * time.Hour
+	}
 	return &Server{
 		Server: &http.Server{
-			Addr: addr,
+			Addr: conf.Port,
 		},
-		Services: services,
-		Line:     line,
+		Services:     services,
+		Line:         line,
+		BaseURL:      strings.TrimSuffix(conf.BaseURL, "/"),
+		AdminToken:   conf.AdminToken,
+		ReportSecret: reportConf.Secret,
+		ReportTTL:    reportTTL,
+		Databases:    databases,
+		Limiter:      limiter,
+		jobs:         newJobs(),
 	}
 }
 
@@ -57,7 +82,8 @@ func (s *Server) ListenAndServe() error {
 	// 公式提供のmiddleware
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(requestLogger)
+	r.Use(instrument)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 
@@ -66,12 +92,20 @@ func (s *Server) ListenAndServe() error {
 	// APIコールしようかなとも考えたが、callback内で解決した方が安全な気がしたので一旦他にルーティングしない
 	r.Route("/v1", func(r chi.Router) {
 		r.Post("/callback", s.callback)
+		r.Get("/events/{eventID}/qrcode", s.eventQRCode)
+		r.Get("/events/{eventID}/report", s.eventReport)
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(s.adminAuth)
+			r.Get("/events/{eventID}/analytics", s.eventAnalytics)
+		})
 	})
 	r.Route("/health", func(r chi.Router) {
-		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-		})
+		// 既存の監視設定のため / は live と同じ扱いにしておく
+		r.Get("/", s.live)
+		r.Get("/live", s.live)
+		r.Get("/ready", s.ready)
 	})
+	r.Handle("/metrics", metrics.Handler())
 
 	s.Handler = r
 	return s.Server.ListenAndServe()
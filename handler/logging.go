@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/mochisuna/linebot-sample/logger"
+)
+
+// requestLogger はリクエストIDを付けたロガーを context に設定し、アクセスログを出力します
+func requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := logger.WithContext(r.Context(), slog.Default().With("request_id", middleware.GetReqID(r.Context())))
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		defer func() {
+			logger.FromContext(ctx).Info("request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", ww.Status(),
+				"bytes", ww.BytesWritten(),
+				"duration_ms", time.Since(start).Milliseconds(),
+				"remote_addr", r.RemoteAddr,
+			)
+		}()
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/service"
+	"github.com/mochisuna/linebot-sample/logger"
+	"github.com/mochisuna/linebot-sample/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// コマンドの処理結果
+const (
+	resultSuccess      = "success"
+	resultNotFound     = "not_found"
+	resultConflict     = "conflict"
+	resultInvalidState = "invalid_state"
+	resultRejected     = "rejected"
+	resultRateLimited  = "rate_limited"
+	resultTimeout      = "timeout"
+	resultInternal     = "internal"
+)
+
+// 集計値の取得でスクレイプが詰まらないようにするための上限
+const statsTimeout = 2 * time.Second
+
+type resultKey struct{}
+
+// commandResult はwebhookイベント1件の処理結果を保持します
+type commandResult struct {
+	result string
+}
+
+func withCommandResult(ctx context.Context) (context.Context, *commandResult) {
+	res := &commandResult{result: resultSuccess}
+	return context.WithValue(ctx, resultKey{}, res), res
+}
+
+// setResult は処理中のコマンドの結果を設定します
+func setResult(ctx context.Context, result string) {
+	if res, ok := ctx.Value(resultKey{}).(*commandResult); ok {
+		res.result = result
+	}
+}
+
+// errorResult はエラーを処理結果の種類に変換します
+func errorResult(err error) string {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return resultNotFound
+	case errors.Is(err, domain.ErrAlreadyParticipated), errors.Is(err, domain.ErrAlreadyParticipating):
+		return resultConflict
+	case errors.Is(err, domain.ErrEventNotOpen), errors.Is(err, domain.ErrEventClosed):
+		return resultInvalidState
+	case errors.Is(err, domain.ErrTooManyPasscodeFailures):
+		return resultRateLimited
+	case errors.Is(err, context.DeadlineExceeded):
+		return resultTimeout
+	default:
+		return resultInternal
+	}
+}
+
+// logError はエラーを出力し、処理中のコマンドの結果として記録します
+func logError(ctx context.Context, err error) {
+	logger.FromContext(ctx).Error("error reason", "error", err)
+	setResult(ctx, errorResult(err))
+}
+
+// observeCommand はwebhookイベント1件の処理結果と処理時間を記録します
+func observeCommand(command string, res *commandResult, start time.Time) {
+	if command == "" {
+		command = "none"
+	}
+	metrics.CommandResults.WithLabelValues(command, res.result).Inc()
+	metrics.CommandDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+}
+
+// instrument はルーティングごとのHTTPリクエストの処理時間を記録します
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+		// 存在しないパスでラベルが増えないようルーティングのパターンを使う
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		metrics.HTTPDuration.WithLabelValues(r.Method, route, strconv.Itoa(ww.Status())).Observe(time.Since(start).Seconds())
+	})
+}
+
+type statsCollector struct {
+	service            service.StatsService
+	openEvents         *prometheus.Desc
+	activeParticipants *prometheus.Desc
+}
+
+// NewStatsCollector はスクレイプ時に開催中のイベント数と参加中のユーザー数を集計する Collector を返します
+func NewStatsCollector(service service.StatsService) prometheus.Collector {
+	return &statsCollector{
+		service:            service,
+		openEvents:         prometheus.NewDesc("linebot_open_events", "Number of open events.", nil, nil),
+		activeParticipants: prometheus.NewDesc("linebot_active_participants", "Number of users participating in an event.", nil, nil),
+	}
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openEvents
+	ch <- c.activeParticipants
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+	stats, err := c.service.GetStats(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to collect stats", "error", err)
+		ch <- prometheus.NewInvalidMetric(c.openEvents, err)
+		ch <- prometheus.NewInvalidMetric(c.activeParticipants, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.openEvents, prometheus.GaugeValue, float64(stats.OpenEvents))
+	ch <- prometheus.MustNewConstMetric(c.activeParticipants, prometheus.GaugeValue, float64(stats.ActiveParticipants))
+}
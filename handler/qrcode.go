@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/logger"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// LINEの画像メッセージの制約に合わせたサイズ
+const (
+	qrCodeOriginalSize = 1024
+	qrCodePreviewSize  = 240
+)
+
+// participateLink は参加コマンドを入力済みにするLINEのディープリンクを返します
+func (s *Server) participateLink(eventID domain.EventID) string {
+	if s.BasicID == "" {
+		return ""
+	}
+	text := ActionEventParticipate + " " + string(eventID)
+	return fmt.Sprintf("https://line.me/R/oaMessage/%v/?%v", url.PathEscape(s.BasicID), url.PathEscape(text))
+}
+
+// lineShareURL は text を友だちに送る画面を開くLINEのURLを返します
+func lineShareURL(text string) string {
+	return "https://line.me/R/share?text=" + url.QueryEscape(text)
+}
+
+// qrCodeURL はイベント参加用QRコード画像のURLを返します
+func (s *Server) qrCodeURL(eventID domain.EventID, size int) string {
+	return fmt.Sprintf("%v/v1/events/%v/qrcode?size=%v", s.BaseURL, url.PathEscape(string(eventID)), size)
+}
+
+// eventQRCode はイベント参加用ディープリンクのQRコードをPNGで返します
+func (s *Server) eventQRCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.FromContext(ctx).Debug("called qrcode.eventQRCode")
+	eventID := domain.EventID(chi.URLParam(r, "eventID"))
+
+	size := qrCodeOriginalSize
+	if v := r.URL.Query().Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < qrCodePreviewSize || n > qrCodeOriginalSize {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+
+	event, err := s.CallbackService.GetEventByEventID(ctx, eventID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logError(ctx, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if event.Status != domain.EVENT_OPEN || event.IsPrivate {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	link := s.participateLink(event.ID)
+	if link == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	png, err := qrcode.Encode(link, qrcode.Medium, size)
+	if err != nil {
+		logError(ctx, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(png)
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/mochisuna/linebot-sample/logger"
+)
+
+// 制限を超えた場合の返信
+const rateLimitedMessage = "操作が続いているため受け付けられませんでした。少し時間をおいてからもう一度お試しください"
+
+// RateLimiter はユーザーとコマンドごとの実行回数の制限
+type RateLimiter interface {
+	Allow(ctx context.Context, userID, command string) (bool, error)
+}
+
+// allow はコマンドを実行してよいかどうかを返します
+// 制限の確認に失敗した場合はbotを止めないよう実行を許可します
+func (s *Server) allow(ctx context.Context, req *linebot.Event, command string) bool {
+	if s.Limiter == nil {
+		return true
+	}
+	if req.Type != linebot.EventTypeMessage && req.Type != linebot.EventTypePostback {
+		return true
+	}
+	allowed, err := s.Limiter.Allow(ctx, req.Source.UserID, command)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to check rate limit", "error", err)
+		return true
+	}
+	return allowed
+}
@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/logger"
+)
+
+// defaultReportTTL はレポートURLの有効時間の既定値
+const defaultReportTTL = 72 * time.Hour
+
+// レポートの推移グラフの大きさと余白
+const (
+	chartWidth   = 640
+	chartHeight  = 200
+	chartPadding = 32
+)
+
+const reportTimeLayout = "2006/01/02 15:04"
+
+//go:embed templates/report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Parse(reportHTML))
+
+type reportView struct {
+	Title             string
+	OpenedAt          string
+	ClosedAt          string
+	Participants      int
+	PeakActive        int
+	Voters            int
+	ParticipationRate string
+	MeanScore         string
+	NetScore          string
+	Distribution      []reportBar
+	Charts            []reportChart
+	Comments          []reportComment
+}
+
+type reportBar struct {
+	Label   string
+	Count   int
+	Percent float64
+}
+
+// reportChart は推移を折れ線で描くための座標
+type reportChart struct {
+	Title                    string
+	Width, Height            int
+	Left, Right, Top, Bottom int
+	Min, Max                 string
+	From, To                 string
+	Points                   string
+}
+
+type reportComment struct {
+	At   string
+	Text string
+}
+
+// reportSignature はイベントIDと有効期限に対する署名を返します
+func (s *Server) reportSignature(eventID domain.EventID, expires int64) []byte {
+	mac := hmac.New(sha256.New, []byte(s.ReportSecret))
+	fmt.Fprintf(mac, "%v\n%v", eventID, expires)
+	return mac.Sum(nil)
+}
+
+// reportURL はレポートの署名付きURLと有効期限を返します。署名の鍵が設定されていない場合は空文字を返す
+func (s *Server) reportURL(eventID domain.EventID, now time.Time) (string, time.Time) {
+	if s.ReportSecret == "" {
+		return "", time.Time{}
+	}
+	expires := now.Add(s.ReportTTL)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("sig", base64.RawURLEncoding.EncodeToString(s.reportSignature(eventID, expires.Unix())))
+	return fmt.Sprintf("%v/v1/events/%v/report?%v", s.BaseURL, url.PathEscape(string(eventID)), query.Encode()), expires
+}
+
+// verifyReport は署名と有効期限を確認し、問題があればレスポンスのステータスコードを返します
+func (s *Server) verifyReport(eventID domain.EventID, query url.Values, now time.Time) int {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return http.StatusBadRequest
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(query.Get("sig"))
+	if err != nil {
+		return http.StatusBadRequest
+	}
+	// 期限切れより先に署名を確認し、改ざんされた期限を信用しない
+	if !hmac.Equal(sig, s.reportSignature(eventID, expires)) {
+		return http.StatusForbidden
+	}
+	if now.Unix() >= expires {
+		return http.StatusGone
+	}
+	return http.StatusOK
+}
+
+// eventReport はイベント終了後のレポートをHTMLで返します
+// URLは終了時に主催者へ渡す署名付きのもののみ受け付けます
+func (s *Server) eventReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.FromContext(ctx).Debug("called report.eventReport")
+	if s.ReportSecret == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	eventID := domain.EventID(chi.URLParam(r, "eventID"))
+	if status := s.verifyReport(eventID, r.URL.Query(), time.Now()); status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	report, err := s.ReportService.GetReport(ctx, eventID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logError(ctx, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var body strings.Builder
+	if err := reportTemplate.Execute(&body, newReportView(report)); err != nil {
+		logError(ctx, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// URLに署名を含むため、リンク元として外部に送らない
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Write([]byte(body.String()))
+}
+
+// newReportView はレポートをテンプレートに渡す表示用の値に変換します
+// コメントは匿名で表示するため投稿者は含めない
+func newReportView(report *domain.Report) *reportView {
+	analytics := report.Analytics
+	view := &reportView{
+		Title:             eventTitle(report.Event),
+		OpenedAt:          formatReportTime(report.Event.OpenedAt),
+		ClosedAt:          formatReportTime(report.Event.UpdatedAt),
+		Participants:      analytics.Participants,
+		PeakActive:        analytics.PeakActive,
+		Voters:            analytics.Voters,
+		ParticipationRate: fmt.Sprintf("%.0f%%", analytics.ParticipationRate*100),
+		MeanScore:         "-",
+		NetScore:          "-",
+	}
+	if analytics.Voters > 0 {
+		view.MeanScore = fmt.Sprintf("%.2f", analytics.MeanScore)
+		view.NetScore = fmt.Sprintf("%+.0f", analytics.NetScore)
+	}
+	for _, c := range analytics.Distribution {
+		bar := reportBar{
+			Label: voteString(c.Vote),
+			Count: c.Count,
+		}
+		if analytics.Voters > 0 {
+			bar.Percent = math.Round(float64(c.Count)*1000/float64(analytics.Voters)) / 10
+		}
+		view.Distribution = append(view.Distribution, bar)
+	}
+
+	active := make([]float64, len(analytics.Timeline))
+	scores := make([]float64, len(analytics.Timeline))
+	for i, b := range analytics.Timeline {
+		active[i] = float64(b.Active)
+		scores[i] = b.MeanScore
+	}
+	view.Charts = []reportChart{
+		newReportChart("参加者数の推移", analytics.Timeline, active, 0, float64(analytics.PeakActive), "%.0f人", false),
+		newReportChart("平均点の推移", analytics.Timeline, scores, 1, float64(domain.GREAT.Score()), "%.0f", true),
+	}
+
+	for _, c := range report.Comments {
+		view.Comments = append(view.Comments, reportComment{
+			At:   formatReportTime(c.CreatedAt),
+			Text: c.Text,
+		})
+	}
+	return view
+}
+
+// newReportChart は値を min から max の範囲でグラフの座標に変換します
+// skipZero の場合は値が 0 の区間 (投票がない区間) を描かない
+func newReportChart(title string, timeline []domain.TimelineBucket, values []float64, min, max float64, label string, skipZero bool) reportChart {
+	chart := reportChart{
+		Title:  title,
+		Width:  chartWidth,
+		Height: chartHeight,
+		Left:   chartPadding,
+		Right:  chartWidth - chartPadding/2,
+		Top:    chartPadding / 2,
+		Bottom: chartHeight - chartPadding,
+		Min:    fmt.Sprintf(label, min),
+		Max:    fmt.Sprintf(label, max),
+	}
+	if len(timeline) == 0 || max <= min {
+		return chart
+	}
+	chart.From = formatReportTime(timeline[0].Start)
+	chart.To = formatReportTime(timeline[len(timeline)-1].Start)
+
+	width := float64(chart.Right - chart.Left)
+	height := float64(chart.Bottom - chart.Top)
+	points := make([]string, 0, len(values))
+	for i, v := range values {
+		if skipZero && v == 0 {
+			continue
+		}
+		x := float64(chart.Left)
+		if len(values) > 1 {
+			x += width * float64(i) / float64(len(values)-1)
+		}
+		y := float64(chart.Bottom) - height*(v-min)/(max-min)
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	// 1点だけでは線にならないので横に伸ばす
+	if len(points) == 1 {
+		points = append(points, fmt.Sprintf("%v,%v", chart.Right, strings.Split(points[0], ",")[1]))
+	}
+	chart.Points = strings.Join(points, " ")
+	return chart
+}
+
+func formatReportTime(unix int) string {
+	if unix <= 0 {
+		return "-"
+	}
+	return time.Unix(int64(unix), 0).Format(reportTimeLayout)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/domain"
+)
+
+func TestVerifyReport(t *testing.T) {
+	s := &Server{BaseURL: "https://example.com", ReportSecret: "secret", ReportTTL: time.Hour}
+	now := time.Unix(1700000000, 0)
+	signed, expires := s.reportURL("e1", now)
+	if !expires.Equal(now.Add(time.Hour)) {
+		t.Fatalf("reportURL() expires = %v, want %v", expires, now.Add(time.Hour))
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/v1/events/e1/report" {
+		t.Errorf("reportURL() path = %v", u.Path)
+	}
+	query := u.Query()
+	with := func(key, value string) url.Values {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set(key, value)
+		return q
+	}
+	other := &Server{ReportSecret: "other"}
+
+	tests := []struct {
+		name    string
+		server  *Server
+		eventID domain.EventID
+		query   url.Values
+		now     time.Time
+		want    int
+	}{
+		{"valid", s, "e1", query, now, http.StatusOK},
+		{"just before expiry", s, "e1", query, expires.Add(-time.Second), http.StatusOK},
+		{"expired", s, "e1", query, expires, http.StatusGone},
+		{"other event", s, "e2", query, now, http.StatusForbidden},
+		{"other secret", other, "e1", query, now, http.StatusForbidden},
+		// 期限を延ばすと署名が合わなくなる
+		{"extended expiry", s, "e1", with("expires", "9999999999"), now, http.StatusForbidden},
+		{"tampered signature", s, "e1", with("sig", "AAAA"), now, http.StatusForbidden},
+		{"missing expiry", s, "e1", with("expires", ""), now, http.StatusBadRequest},
+		{"broken signature", s, "e1", with("sig", "!"), now, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.server.verifyReport(tt.eventID, tt.query, tt.now); got != tt.want {
+				t.Errorf("verifyReport() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportURLWithoutSecret(t *testing.T) {
+	s := &Server{BaseURL: "https://example.com", ReportTTL: time.Hour}
+	if got, expires := s.reportURL("e1", time.Now()); got != "" || !expires.IsZero() {
+		t.Errorf("reportURL() = %q, %v, want empty", got, expires)
+	}
+}
+
+func TestNewReportViewPeriod(t *testing.T) {
+	registered := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+	opened := registered.Add(2 * time.Hour)
+	closed := opened.Add(time.Hour)
+	tests := []struct {
+		name     string
+		openedAt int
+		want     string
+	}{
+		// スタンバイの登録時刻ではなく開催した時刻を表示する
+		{"opened", int(opened.Unix()), opened.Format(reportTimeLayout)},
+		{"opened before the time was recorded", 0, "-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view := newReportView(&domain.Report{
+				Event: &domain.Event{
+					Title:     "title",
+					OpenedAt:  tt.openedAt,
+					CreatedAt: int(registered.Unix()),
+					UpdatedAt: int(closed.Unix()),
+				},
+				Analytics: &domain.Analytics{},
+			})
+			if view.OpenedAt != tt.want {
+				t.Errorf("OpenedAt = %v, want %v", view.OpenedAt, tt.want)
+			}
+			if want := closed.Format(reportTimeLayout); view.ClosedAt != want {
+				t.Errorf("ClosedAt = %v, want %v", view.ClosedAt, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/infrastructure/cache"
+	"github.com/mochisuna/linebot-sample/logger"
+	"github.com/mochisuna/linebot-sample/metrics"
+)
+
+// キャッシュの名前空間。世代を進めると名前空間内のキーがまとめて無効になる
+const (
+	cacheEvent = "event" // イベントと主催者からの参照
+	cacheList  = "list"  // 一覧。イベントと参加状況の変更で無効にする
+	cacheUser  = "user"  // ユーザーの参加状況
+)
+
+// TTLが設定されていない場合の既定値
+const defaultCacheTTL = 30 * time.Second
+
+// errNoCache は読み込みに成功したがキャッシュしない結果を load に伝えるためのエラー
+var errNoCache = errors.New("not cacheable")
+
+// cacheEntry は該当なしも含めて保存するための入れ物
+type cacheEntry struct {
+	Found bool            `json:"found"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// cacher はリポジトリの読み込み結果のキャッシュとその無効化を行います
+// キャッシュの障害時はデータベースから読み込み、処理は止めない
+type cacher struct {
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+func newCacher(c cache.Cache, ttl time.Duration) *cacher {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &cacher{cache: c, ttl: ttl}
+}
+
+// key は名前空間の現在の世代を含めたキーを返します。世代を取得できない場合はキャッシュを使わない
+func (c *cacher) key(ctx context.Context, namespace string, parts ...interface{}) (string, bool) {
+	gen, err := c.cache.Generation(ctx, namespace)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get cache generation", "error", err)
+		return "", false
+	}
+	strs := make([]string, len(parts))
+	for i, part := range parts {
+		strs[i] = fmt.Sprint(part)
+	}
+	return fmt.Sprintf("%v:%v:%v", namespace, gen, strings.Join(strs, ":")), true
+}
+
+// load はキャッシュにあればそれを dest に読み込み、なければ fn で読み込んでキャッシュします
+// fn が errNoCache を返した場合は dest をそのまま返し、キャッシュしない
+// トランザクション中はコミット前の状態を読むためキャッシュを使わない
+// キャッシュする値は全てのユーザーに返すため、無効化の直後に遅延したレプリカの値を残さないようマスターから読み込む
+func (c *cacher) load(ctx context.Context, name, namespace string, dest interface{}, fn func(context.Context) error, parts ...interface{}) error {
+	if inTx(ctx) || repository.IsPrimary(ctx) {
+		return skipNoCache(fn(ctx))
+	}
+	key, ok := c.key(ctx, namespace, parts...)
+	if !ok {
+		metrics.CacheRequests.WithLabelValues(name, "error").Inc()
+		return skipNoCache(fn(ctx))
+	}
+	body, hit, err := c.cache.Get(ctx, key)
+	var entry cacheEntry
+	switch {
+	case err != nil:
+		logger.FromContext(ctx).Warn("failed to get cache", "error", err)
+		metrics.CacheRequests.WithLabelValues(name, "error").Inc()
+	case hit && json.Unmarshal(body, &entry) == nil:
+		metrics.CacheRequests.WithLabelValues(name, "hit").Inc()
+		if !entry.Found {
+			return sql.ErrNoRows
+		}
+		if err := json.Unmarshal(entry.Value, dest); err == nil {
+			return nil
+		}
+	default:
+		metrics.CacheRequests.WithLabelValues(name, "miss").Inc()
+	}
+
+	err = fn(repository.WithPrimary(ctx))
+	switch err {
+	case errNoCache:
+		return nil
+	case nil:
+		value, merr := json.Marshal(dest)
+		if merr != nil {
+			return nil
+		}
+		entry = cacheEntry{Found: true, Value: value}
+	case sql.ErrNoRows:
+		// ほとんどのユーザーは主催中のイベントを持たないため、該当なしもキャッシュする
+		entry = cacheEntry{Found: false}
+	default:
+		return err
+	}
+	if body, merr := json.Marshal(entry); merr == nil {
+		if serr := c.cache.Set(ctx, key, body, c.ttl); serr != nil {
+			logger.FromContext(ctx).Warn("failed to set cache", "error", serr)
+		}
+	}
+	return err
+}
+
+func skipNoCache(err error) error {
+	if err == errNoCache {
+		return nil
+	}
+	return err
+}
+
+// invalidate はコミット後に名前空間の世代を進めます
+func (c *cacher) invalidate(ctx context.Context, namespaces ...string) {
+	// リクエストのタイムアウト後でも無効化は済ませる
+	ctx = context.WithoutCancel(ctx)
+	afterCommit(ctx, func() {
+		for _, namespace := range namespaces {
+			if err := c.cache.Incr(ctx, namespace); err != nil {
+				logger.FromContext(ctx).Error("failed to invalidate cache", "namespace", namespace, "error", err)
+			}
+		}
+	})
+}
+
+// invalidateUser はコミット後にユーザーの参加状況のキャッシュを消します
+func (c *cacher) invalidateUser(ctx context.Context, userID domain.UserID) {
+	ctx = context.WithoutCancel(ctx)
+	afterCommit(ctx, func() {
+		participating, ok := c.key(ctx, cacheUser, "participating", userID)
+		if !ok {
+			return
+		}
+		keys := []string{participating}
+		if gen, err := c.cache.Generation(ctx, cacheEvent); err == nil {
+			if key, ok := c.key(ctx, cacheUser, "context", gen, userID); ok {
+				keys = append(keys, key)
+			}
+		}
+		if err := c.cache.Delete(ctx, keys...); err != nil {
+			logger.FromContext(ctx).Error("failed to invalidate cache", "namespace", cacheUser, "error", err)
+		}
+	})
+}
+
+func statusKey(status *domain.EventStatus) string {
+	if status == nil {
+		return "any"
+	}
+	return fmt.Sprint(*status)
+}
+
+// privateEventError は非公開イベントをキャッシュしないようにします
+// パスコードをキャッシュに平文で残さず、取得したイベントをそのまま更新してもパスコードが消えないようにする
+func privateEventError(event *domain.Event, err error) error {
+	if err == nil && event.IsPrivate {
+		return errNoCache
+	}
+	return err
+}
+
+type cachedEventRepository struct {
+	repository.EventRepository
+	cache *cacher
+}
+
+// NewCachedEventRepository はイベントの参照結果をキャッシュするリポジトリを返します
+func NewCachedEventRepository(repo repository.EventRepository, c cache.Cache, ttl time.Duration) repository.EventRepository {
+	return &cachedEventRepository{
+		EventRepository: repo,
+		cache:           newCacher(c, ttl),
+	}
+}
+
+func (r *cachedEventRepository) SelectByOrganizerID(ctx context.Context, ownerID domain.OwnerID, status *domain.EventStatus) (*domain.Event, error) {
+	event := &domain.Event{}
+	err := r.cache.load(ctx, "event.SelectByOrganizerID", cacheEvent, event, func(ctx context.Context) error {
+		ret, err := r.EventRepository.SelectByOrganizerID(ctx, ownerID, status)
+		if ret != nil {
+			*event = *ret
+		}
+		return privateEventError(event, err)
+	}, "organizer", ownerID, statusKey(status))
+	return event, err
+}
+
+func (r *cachedEventRepository) SelectByEventID(ctx context.Context, eventID domain.EventID) (*domain.Event, error) {
+	event := &domain.Event{}
+	err := r.cache.load(ctx, "event.SelectByEventID", cacheEvent, event, func(ctx context.Context) error {
+		ret, err := r.EventRepository.SelectByEventID(ctx, eventID)
+		if ret != nil {
+			*event = *ret
+		}
+		return privateEventError(event, err)
+	}, "id", eventID)
+	return event, err
+}
+
+func (r *cachedEventRepository) SelectList(ctx context.Context, query *domain.EventListQuery) ([]domain.EventSummary, error) {
+	var list []domain.EventSummary
+	err := r.cache.load(ctx, "event.SelectList", cacheList, &list, func(ctx context.Context) error {
+		var err error
+		list, err = r.EventRepository.SelectList(ctx, query)
+		return err
+	}, statusKey(query.Status), query.IncludePrivate, query.Order, query.Offset, query.Limit)
+	return list, err
+}
+
+func (r *cachedEventRepository) Create(ctx context.Context, event *domain.Event) error {
+	if err := r.EventRepository.Create(ctx, event); err != nil {
+		return err
+	}
+	r.cache.invalidate(ctx, cacheEvent, cacheList)
+	return nil
+}
+
+func (r *cachedEventRepository) Update(ctx context.Context, event *domain.Event) error {
+	if err := r.EventRepository.Update(ctx, event); err != nil {
+		return err
+	}
+	r.cache.invalidate(ctx, cacheEvent, cacheList)
+	return nil
+}
+
+type cachedUserRepository struct {
+	repository.UserRepository
+	cache *cacher
+}
+
+// NewCachedUserRepository はユーザーの参加状況をキャッシュするリポジトリを返します
+func NewCachedUserRepository(repo repository.UserRepository, c cache.Cache, ttl time.Duration) repository.UserRepository {
+	return &cachedUserRepository{
+		UserRepository: repo,
+		cache:          newCacher(c, ttl),
+	}
+}
+
+// SelectByIDAndStatus は参加中のイベントの参照のみキャッシュします
+func (r *cachedUserRepository) SelectByIDAndStatus(ctx context.Context, userID *domain.UserID, isParticipated bool) (*domain.User, error) {
+	if !isParticipated {
+		return r.UserRepository.SelectByIDAndStatus(ctx, userID, isParticipated)
+	}
+	user := &domain.User{}
+	err := r.cache.load(ctx, "user.SelectByIDAndStatus", cacheUser, user, func(ctx context.Context) error {
+		ret, err := r.UserRepository.SelectByIDAndStatus(ctx, userID, isParticipated)
+		if ret != nil {
+			*user = *ret
+		}
+		return err
+	}, "participating", *userID)
+	return user, err
+}
+
+// SelectContext はイベントの世代もキーに含め、主催者やイベントの変更でも無効になるようにします
+// パスコードはキャッシュに平文で残さないよう空にする。必要な場合は SelectByJoinCode などで取得し直す
+func (r *cachedUserRepository) SelectContext(ctx context.Context, userID domain.UserID) (*domain.UserContext, error) {
+	gen, err := r.cache.cache.Generation(ctx, cacheEvent)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to get cache generation", "error", err)
+		return r.UserRepository.SelectContext(ctx, userID)
+	}
+	uc := &domain.UserContext{}
+	err = r.cache.load(ctx, "user.SelectContext", cacheUser, uc, func(ctx context.Context) error {
+		ret, err := r.UserRepository.SelectContext(ctx, userID)
+		if ret != nil {
+			*uc = *ret
+			uc.OwnedEvent = withoutPasscode(uc.OwnedEvent)
+			uc.ParticipatedEvent = withoutPasscode(uc.ParticipatedEvent)
+		}
+		return err
+	}, "context", gen, userID)
+	return uc, err
+}
+
+// withoutPasscode はパスコードを空にしたイベントのコピーを返します
+func withoutPasscode(event *domain.Event) *domain.Event {
+	if event == nil {
+		return nil
+	}
+	e := *event
+	e.Passcode = ""
+	return &e
+}
+
+func (r *cachedUserRepository) Update(ctx context.Context, user *domain.User) error {
+	if err := r.UserRepository.Update(ctx, user); err != nil {
+		return err
+	}
+	r.cache.invalidateUser(ctx, user.ID)
+	r.cache.invalidate(ctx, cacheList)
+	return nil
+}
+
+func (r *cachedUserRepository) Participate(ctx context.Context, user *domain.User) error {
+	if err := r.UserRepository.Participate(ctx, user); err != nil {
+		return err
+	}
+	r.cache.invalidateUser(ctx, user.ID)
+	r.cache.invalidate(ctx, cacheList)
+	return nil
+}
+
+func (r *cachedUserRepository) Vote(ctx context.Context, user *domain.User) error {
+	if err := r.UserRepository.Vote(ctx, user); err != nil {
+		return err
+	}
+	r.cache.invalidateUser(ctx, user.ID)
+	return nil
+}
+
+func (r *cachedUserRepository) LeaveByEventID(ctx context.Context, eventID domain.EventID, updatedAt int) error {
+	if err := r.UserRepository.LeaveByEventID(ctx, eventID, updatedAt); err != nil {
+		return err
+	}
+	// 参加者ごとには消せないためユーザーの参加状況をまとめて無効にする
+	r.cache.invalidate(ctx, cacheUser, cacheList)
+	return nil
+}
+
+type cachedOrganizerRepository struct {
+	repository.OrganizerRepository
+	cache *cacher
+}
+
+// NewCachedOrganizerRepository は主催者の変更時にイベントのキャッシュを無効にするリポジトリを返します
+func NewCachedOrganizerRepository(repo repository.OrganizerRepository, c cache.Cache, ttl time.Duration) repository.OrganizerRepository {
+	return &cachedOrganizerRepository{
+		OrganizerRepository: repo,
+		cache:               newCacher(c, ttl),
+	}
+}
+
+func (r *cachedOrganizerRepository) Create(ctx context.Context, organizer *domain.Organizer) error {
+	if err := r.OrganizerRepository.Create(ctx, organizer); err != nil {
+		return err
+	}
+	r.cache.invalidate(ctx, cacheEvent)
+	return nil
+}
+
+func (r *cachedOrganizerRepository) Delete(ctx context.Context, organizer *domain.Organizer) error {
+	if err := r.OrganizerRepository.Delete(ctx, organizer); err != nil {
+		return err
+	}
+	r.cache.invalidate(ctx, cacheEvent)
+	return nil
+}
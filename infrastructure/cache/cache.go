@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/config"
+)
+
+// キャッシュの保存先
+const (
+	BackendNone   = "none"
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// 件数が設定されていない場合のインメモリキャッシュの既定の件数
+const defaultSize = 10000
+
+// Cache はリポジトリの読み込み結果を保持するキャッシュ
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// Generation は名前空間の世代を返します。Incr で世代を進めると古い世代のキーは参照されなくなります
+	Generation(ctx context.Context, namespace string) (int64, error)
+	Incr(ctx context.Context, namespace string) error
+}
+
+// New は設定に従ってキャッシュを生成します。無効な場合は nil を返します
+func New(conf *config.Cache) (Cache, error) {
+	switch conf.Backend {
+	case "", BackendNone:
+		return nil, nil
+	case BackendMemory:
+		return NewLRU(conf.Size), nil
+	case BackendRedis:
+		return NewRedis(conf)
+	default:
+		return nil, fmt.Errorf("unknown cache backend: %v", conf.Backend)
+	}
+}
+
+type entry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// LRU はプロセス内で件数を上限に古いものから捨てるキャッシュ
+// 複数台で動かす場合は他のプロセスでの更新が反映されないため、TTLを短くするか Redis を使う
+type LRU struct {
+	size        int
+	mu          sync.Mutex
+	items       map[string]*list.Element
+	order       *list.List
+	generations map[string]int64 // 世代は追い出されると古い値が復活するため別に持つ
+}
+
+func NewLRU(size int) *LRU {
+	if size <= 0 {
+		size = defaultSize
+	}
+	return &LRU{
+		size:        size,
+		items:       map[string]*list.Element{},
+		order:       list.New(),
+		generations: map[string]int64{},
+	}
+}
+
+func (c *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := elem.Value.(*entry)
+	if time.Now().After(e.expiresAt) {
+		c.remove(elem)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(elem)
+	return e.value, true, nil
+}
+
+func (c *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiresAt := time.Now().Add(ttl)
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry)
+		e.value = value
+		e.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	c.items[key] = c.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *LRU) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if elem, ok := c.items[key]; ok {
+			c.remove(elem)
+		}
+	}
+	return nil
+}
+
+func (c *LRU) Generation(_ context.Context, namespace string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[namespace], nil
+}
+
+func (c *LRU) Incr(_ context.Context, namespace string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[namespace]++
+	return nil
+}
+
+func (c *LRU) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*entry).key)
+}
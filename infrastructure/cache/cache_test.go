@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		run  func(ctx context.Context, c *LRU)
+		hit  map[string]bool
+	}{
+		{
+			name: "evicts least recently used",
+			size: 2,
+			run: func(ctx context.Context, c *LRU) {
+				c.Set(ctx, "a", []byte("a"), time.Minute)
+				c.Set(ctx, "b", []byte("b"), time.Minute)
+				c.Get(ctx, "a")
+				c.Set(ctx, "c", []byte("c"), time.Minute)
+			},
+			hit: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name: "overwrite refreshes order",
+			size: 2,
+			run: func(ctx context.Context, c *LRU) {
+				c.Set(ctx, "a", []byte("a"), time.Minute)
+				c.Set(ctx, "b", []byte("b"), time.Minute)
+				c.Set(ctx, "a", []byte("a2"), time.Minute)
+				c.Set(ctx, "c", []byte("c"), time.Minute)
+			},
+			hit: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name: "expired",
+			size: 2,
+			run: func(ctx context.Context, c *LRU) {
+				c.Set(ctx, "a", []byte("a"), -time.Second)
+				c.Set(ctx, "b", []byte("b"), time.Minute)
+			},
+			hit: map[string]bool{"a": false, "b": true},
+		},
+		{
+			name: "delete",
+			size: 2,
+			run: func(ctx context.Context, c *LRU) {
+				c.Set(ctx, "a", []byte("a"), time.Minute)
+				c.Set(ctx, "b", []byte("b"), time.Minute)
+				c.Delete(ctx, "a", "missing")
+			},
+			hit: map[string]bool{"a": false, "b": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := NewLRU(tt.size)
+			tt.run(ctx, c)
+			for key, want := range tt.hit {
+				if _, hit, err := c.Get(ctx, key); err != nil || hit != want {
+					t.Errorf("Get(%v) hit = %v, %v, want %v", key, hit, err, want)
+				}
+			}
+			if c.order.Len() != len(c.items) || c.order.Len() > tt.size {
+				t.Errorf("len(order) = %v, len(items) = %v, size = %v", c.order.Len(), len(c.items), tt.size)
+			}
+		})
+	}
+}
+
+func TestLRUGeneration(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(1)
+	if gen, err := c.Generation(ctx, "event"); err != nil || gen != 0 {
+		t.Fatalf("Generation() = %v, %v, want 0", gen, err)
+	}
+	c.Incr(ctx, "event")
+	c.Incr(ctx, "event")
+	// 値の追い出しで世代が戻らない
+	c.Set(ctx, "a", []byte("a"), time.Minute)
+	c.Set(ctx, "b", []byte("b"), time.Minute)
+	if gen, err := c.Generation(ctx, "event"); err != nil || gen != 2 {
+		t.Errorf("Generation() = %v, %v, want 2", gen, err)
+	}
+	if gen, err := c.Generation(ctx, "list"); err != nil || gen != 0 {
+		t.Errorf("Generation(other namespace) = %v, %v, want 0", gen, err)
+	}
+}
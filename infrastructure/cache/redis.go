@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// キーの接頭辞。同じRedisを他の用途と共有しても衝突しないようにする
+const redisPrefix = "linebot:"
+
+// Redis は複数台で共有するキャッシュ
+type Redis struct {
+	client *redis.Client
+}
+
+func NewRedis(conf *config.Cache) (*Redis, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.RedisAddr,
+		Password: conf.RedisPassword,
+		DB:       conf.RedisDB,
+	})
+	// 起動時に接続できることを確認しておく
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Redis{client: client}, nil
+}
+
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, redisPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, redisPrefix+key, value, ttl).Err()
+}
+
+func (c *Redis) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = redisPrefix + key
+	}
+	return c.client.Del(ctx, prefixed...).Err()
+}
+
+// Generation の値は有効期限なしで保存する
+func (c *Redis) Generation(ctx context.Context, namespace string) (int64, error) {
+	gen, err := c.client.Get(ctx, redisPrefix+"gen:"+namespace).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return gen, err
+}
+
+func (c *Redis) Incr(ctx context.Context, namespace string) error {
+	return c.client.Incr(ctx, redisPrefix+"gen:"+namespace).Err()
+}
+
+func (c *Redis) Close() error {
+	return c.client.Close()
+}
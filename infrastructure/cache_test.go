@@ -0,0 +1,116 @@
+package infrastructure_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/infrastructure"
+	"github.com/mochisuna/linebot-sample/infrastructure/cache"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+)
+
+// recordingCache は保存された値を記録します
+type recordingCache struct {
+	*cache.LRU
+	values [][]byte
+}
+
+func (c *recordingCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.values = append(c.values, value)
+	return c.LRU.Set(ctx, key, value, ttl)
+}
+
+func TestCachedEventRepositoryInvalidation(t *testing.T) {
+	ctx := context.Background()
+	client := newTestDB(t, db.DriverSQLite)
+	repo := infrastructure.NewEventRepository(client, client)
+	cached := infrastructure.NewCachedEventRepository(repo, cache.NewLRU(0), 0)
+	event := createEvent(t, client, "e1", "Uowner", "111111")
+
+	if _, err := cached.SelectByEventID(ctx, event.ID); err != nil {
+		t.Fatal(err)
+	}
+	// キャッシュを通さない更新は反映されない
+	event.Title = "changed"
+	if err := repo.Update(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cached.SelectByEventID(ctx, event.ID); err != nil || got.Title != "title e1" {
+		t.Fatalf("SelectByEventID() = %+v, %v, want cached title", got, err)
+	}
+	// キャッシュを通した更新で世代が進み、読み直す
+	event.Title = "updated"
+	if err := cached.Update(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cached.SelectByEventID(ctx, event.ID); err != nil || got.Title != "updated" {
+		t.Errorf("SelectByEventID() after Update = %+v, %v, want updated title", got, err)
+	}
+}
+
+func TestCachedEventRepositoryReplicaLag(t *testing.T) {
+	// 別々のファイルをマスターと、更新が届いていないレプリカとして使う
+	primary := newTestDB(t, db.DriverSQLite)
+	replica := newTestDB(t, db.DriverSQLite)
+	replica.SetPrimary(primary)
+	primary.TrackWrites(time.Minute)
+	event := createEvent(t, primary, "e1", "Uowner", "111111")
+	createEvent(t, replica, "e1", "Uowner", "111111")
+	cached := infrastructure.NewCachedEventRepository(infrastructure.NewEventRepository(primary, replica), cache.NewLRU(0), 0)
+
+	owner := repository.WithActor(context.Background(), string(event.OwnerID))
+	event.Title = "updated"
+	if err := infrastructure.NewTxManager(primary).Do(owner, func(ctx context.Context) error {
+		return cached.Update(ctx, event)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// 書き込んだユーザー以外の読み込みでも、無効化直後に古い値をキャッシュしない
+	for _, actor := range []string{"Uuser", string(event.OwnerID)} {
+		ctx := repository.WithActor(context.Background(), actor)
+		if got, err := cached.SelectByEventID(ctx, event.ID); err != nil || got.Title != "updated" {
+			t.Errorf("SelectByEventID(%v) = %+v, %v, want updated title", actor, got, err)
+		}
+	}
+}
+
+func TestCachedRepositoryPasscode(t *testing.T) {
+	ctx := context.Background()
+	client := newTestDB(t, db.DriverSQLite)
+	c := &recordingCache{LRU: cache.NewLRU(0)}
+	events := infrastructure.NewCachedEventRepository(infrastructure.NewEventRepository(client, client), c, 0)
+	users := infrastructure.NewCachedUserRepository(infrastructure.NewUserRepository(client, client), c, 0)
+	event := createEvent(t, client, "e1", "Uowner", "111111")
+	event.IsPrivate = true
+	event.Passcode = "1234"
+	if err := events.Update(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		// 非公開イベントはキャッシュしないので、取得したまま更新してもパスコードは残る
+		got, err := events.SelectByEventID(ctx, event.ID)
+		if err != nil || got.Passcode != "1234" {
+			t.Fatalf("SelectByEventID() = %+v, %v, want passcode", got, err)
+		}
+		uc, err := users.SelectContext(ctx, domain.UserID(event.OwnerID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uc.OwnedEvent == nil || uc.OwnedEvent.ID != event.ID || uc.OwnedEvent.Passcode != "" {
+			t.Fatalf("SelectContext().OwnedEvent = %+v, want event without passcode", uc.OwnedEvent)
+		}
+	}
+	if len(c.values) == 0 {
+		t.Fatal("nothing was cached")
+	}
+	for _, value := range c.values {
+		if bytes.Contains(value, []byte("1234")) {
+			t.Errorf("passcode was cached: %s", value)
+		}
+	}
+}
@@ -1,7 +1,15 @@
 package infrastructure
 
 import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"modernc.org/sqlite"
 )
 
 const (
@@ -10,13 +18,90 @@ const (
 	EVENTS             = "events"
 	EVENT_PARTICIPANTS = "event_participants"
 	EVENT_VOTES        = "event_votes"
+	VOTE_HISTORIES     = "event_vote_histories"
+	EVENT_COMMENTS     = "event_comments"
+	EVENT_ORGANIZERS   = "event_organizers"
+	EVENT_INVITATIONS  = "event_invitations"
+	PASSCODE_FAILURES  = "event_passcode_failures"
 )
 
+// MySQLの一意制約違反のエラー番号
+const errDuplicateEntry = 1062
+
+// PostgreSQLの一意制約違反のエラーコード
+const errUniqueViolation = "23505"
+
+// SQLiteの主キー制約違反と一意制約違反の拡張エラーコード
+const (
+	errSQLitePrimaryKey = 1555
+	errSQLiteUnique     = 2067
+)
+
+// sqliteUniqueColumns は一意インデックスの名前と、SQLiteのエラーに含まれる {テーブル名}.{カラム名}
+// SQLiteのエラーにはインデックス名が含まれないため、カラムで区別する
+var sqliteUniqueColumns = map[string]string{
+	"uniq_active_join_code": EVENT_STATUSES + ".join_code",
+	"uniq_active_user_id":   EVENT_PARTICIPANTS + ".user_id",
+}
+
+// isDuplicateKey は指定したキーの一意制約違反かどうかを返します
+// 主キーはMySQLに合わせて PRIMARY で指定します
+func isDuplicateKey(err error, key string) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == errDuplicateEntry && strings.Contains(mysqlErr.Message, key)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if pgErr.Code != errUniqueViolation {
+			return false
+		}
+		// PostgreSQLの主キー制約名は {テーブル名}_pkey
+		if key == "PRIMARY" {
+			return strings.HasSuffix(pgErr.ConstraintName, "_pkey")
+		}
+		return pgErr.ConstraintName == key
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		if key == "PRIMARY" {
+			return sqliteErr.Code() == errSQLitePrimaryKey
+		}
+		columns, ok := sqliteUniqueColumns[key]
+		return ok && sqliteErr.Code() == errSQLiteUnique && sqliteUniqueViolation(sqliteErr.Error()) == columns
+	}
+	return false
+}
+
+// sqliteUniqueViolation は "UNIQUE constraint failed: {テーブル名}.{カラム名}" のエラーから違反したカラムを返します
+func sqliteUniqueViolation(message string) string {
+	const prefix = "UNIQUE constraint failed: "
+	i := strings.Index(message, prefix)
+	if i < 0 {
+		return ""
+	}
+	columns := message[i+len(prefix):]
+	// modernc.org/sqlite はエラーコードを末尾に付ける
+	if j := strings.LastIndex(columns, " ("); j >= 0 {
+		columns = columns[:j]
+	}
+	return columns
+}
+
+// ignoreDuplicate は一意制約に違反する行の挿入を無視するための句を返します
+func ignoreDuplicate(client *db.Client, column string) string {
+	if client.Driver == db.DriverPostgres || client.Driver == db.DriverSQLite {
+		return "ON CONFLICT DO NOTHING"
+	}
+	return "ON DUPLICATE KEY UPDATE " + column + " = " + column
+}
+
 // gorpを使わないので厳密には不要だがカラムと同じ構造体を持たせておいた方が取り回しがしやすい
 type ownerColumns struct {
-	OwnerID   domain.OwnerID `db:"owner_id"`
-	CreatedAt int            `db:"created_at"`
-	UpdatedAt int            `db:"updated_at"`
+	OwnerID     domain.OwnerID `db:"owner_id"`
+	DisplayName string         `db:"display_name"`
+	CreatedAt   int            `db:"created_at"`
+	UpdatedAt   int            `db:"updated_at"`
 }
 type eventColumns struct {
 	ID        int            `db:"id"`
@@ -26,11 +111,20 @@ type eventColumns struct {
 }
 
 type eventStatusColumns struct {
-	EventID   domain.EventID     `db:"event_id"`
-	OwnerID   domain.OwnerID     `db:"owner_id"`
-	Status    domain.EventStatus `db:"status"`
-	CreatedAt int                `db:"created_at"`
-	UpdatedAt int                `db:"updated_at"`
+	EventID      domain.EventID     `db:"event_id"`
+	OwnerID      domain.OwnerID     `db:"owner_id"`
+	Status       domain.EventStatus `db:"status"`
+	Title        string             `db:"title"`
+	JoinCode     sql.NullString     `db:"join_code"`
+	IsPrivate    bool               `db:"is_private"`
+	Passcode     sql.NullString     `db:"passcode"`
+	IsVoting     bool               `db:"is_voting"`
+	VoteClosesAt int                `db:"vote_closes_at"`
+	VoteOpenedAt int                `db:"vote_opened_at"`
+	VotePolicy   domain.VotePolicy  `db:"vote_policy"`
+	OpenedAt     int                `db:"opened_at"`
+	CreatedAt    int                `db:"created_at"`
+	UpdatedAt    int                `db:"updated_at"`
 }
 
 type eventParticipantsColumns struct {
@@ -48,3 +142,43 @@ type eventVotesColumns struct {
 	CreatedAt int                `db:"created_at"`
 	UpdatedAt int                `db:"updated_at"`
 }
+
+type eventVoteHistoriesColumns struct {
+	ID           int                `db:"id"`
+	EventID      domain.EventID     `db:"event_id"`
+	UserID       domain.UserID      `db:"user_id"`
+	Vote         domain.VOTE_STATUS `db:"vote"`
+	PreviousVote domain.VOTE_STATUS `db:"previous_vote"`
+	CreatedAt    int                `db:"created_at"`
+}
+
+type eventCommentsColumns struct {
+	ID        int            `db:"id"`
+	EventID   domain.EventID `db:"event_id"`
+	UserID    domain.UserID  `db:"user_id"`
+	Comment   string         `db:"comment"`
+	CreatedAt int            `db:"created_at"`
+}
+
+type eventOrganizersColumns struct {
+	EventID   domain.EventID       `db:"event_id"`
+	OwnerID   domain.OwnerID       `db:"owner_id"`
+	Role      domain.OrganizerRole `db:"role"`
+	CreatedAt int                  `db:"created_at"`
+	UpdatedAt int                  `db:"updated_at"`
+}
+
+type eventInvitationsColumns struct {
+	InviteCode string         `db:"invite_code"`
+	EventID    domain.EventID `db:"event_id"`
+	OwnerID    domain.OwnerID `db:"owner_id"`
+	CreatedAt  int            `db:"created_at"`
+	UpdatedAt  int            `db:"updated_at"`
+}
+
+type eventPasscodeFailuresColumns struct {
+	ID        int            `db:"id"`
+	EventID   domain.EventID `db:"event_id"`
+	UserID    domain.UserID  `db:"user_id"`
+	CreatedAt int            `db:"created_at"`
+}
@@ -0,0 +1,71 @@
+package infrastructure
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mochisuna/linebot-sample/config"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/infrastructure/migration"
+)
+
+// TestIsDuplicateKeySQLite はSQLiteでも違反した一意インデックスを区別できることを確認します
+func TestIsDuplicateKeySQLite(t *testing.T) {
+	ctx := context.Background()
+	client, err := db.New(&config.DB{Driver: db.DriverSQLite, Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	migrator, err := migration.New(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		`INSERT INTO event_statuses (owner_id, event_id, status, join_code, created_at, updated_at) VALUES ('Uowner', 'e1', 1, '111111', 100, 100)`,
+		`INSERT INTO event_participants (user_id, event_id, is_participated, created_at, updated_at) VALUES ('Uuser', 'e1', 1, 100, 100)`,
+	} {
+		if _, err := client.ExecContext(ctx, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  map[string]bool
+	}{
+		{
+			name:  "join code",
+			query: `INSERT INTO event_statuses (owner_id, event_id, status, join_code, created_at, updated_at) VALUES ('Uowner', 'e2', 1, '111111', 100, 100)`,
+			want:  map[string]bool{"uniq_active_join_code": true, "uniq_active_user_id": false, "PRIMARY": false},
+		},
+		{
+			name:  "active participation",
+			query: `INSERT INTO event_participants (user_id, event_id, is_participated, created_at, updated_at) VALUES ('Uuser', 'e2', 1, 100, 100)`,
+			want:  map[string]bool{"uniq_active_join_code": false, "uniq_active_user_id": true, "PRIMARY": false},
+		},
+		{
+			name:  "primary key",
+			query: `INSERT INTO event_participants (user_id, event_id, is_participated, created_at, updated_at) VALUES ('Uuser', 'e1', 0, 100, 100)`,
+			want:  map[string]bool{"uniq_active_join_code": false, "uniq_active_user_id": false, "PRIMARY": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.ExecContext(ctx, tt.query)
+			if err == nil {
+				t.Fatal("no constraint violation")
+			}
+			for key, want := range tt.want {
+				if got := isDuplicateKey(err, key); got != want {
+					t.Errorf("isDuplicateKey(%q, %v) = %v, want %v", err, key, got, want)
+				}
+			}
+		})
+	}
+}
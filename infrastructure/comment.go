@@ -0,0 +1,70 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/logger"
+)
+
+type commentRepository struct {
+	dbm *db.Client
+	dbs *db.Client
+}
+
+func NewCommentRepository(dbmClient *db.Client, dbsClient *db.Client) repository.CommentRepository {
+	return &commentRepository{
+		dbm: dbmClient,
+		dbs: dbsClient,
+	}
+}
+
+// SelectByEventID はイベントのコメントを古い順に返します
+func (r *commentRepository) SelectByEventID(ctx context.Context, eventID domain.EventID) ([]domain.Comment, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.comment SelectByEventID")
+	rows, err := squirrel.Select("event_id", "user_id", "comment", "created_at").
+		From(EVENT_COMMENTS).
+		Where(squirrel.Eq{
+			"event_id": eventID,
+		}).
+		OrderBy("created_at ASC", "id ASC").
+		RunWith(runner(ctx, r.dbs)).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []domain.Comment
+	for rows.Next() {
+		var col eventCommentsColumns
+		err := rows.Scan(
+			&col.EventID,
+			&col.UserID,
+			&col.Comment,
+			&col.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, domain.Comment{
+			EventID:   col.EventID,
+			UserID:    col.UserID,
+			Text:      col.Comment,
+			CreatedAt: col.CreatedAt,
+		})
+	}
+	return ret, rows.Err()
+}
+
+func (r *commentRepository) Create(ctx context.Context, comment *domain.Comment) error {
+	logger.FromContext(ctx).Debug("called infrastructure.comment Create")
+	_, err := squirrel.Insert(EVENT_COMMENTS).
+		Columns("event_id", "user_id", "comment", "created_at").
+		Values(comment.EventID, comment.UserID, comment.Text, comment.CreatedAt).
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
+	return err
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/config"
+)
+
+// 対応しているデータベース
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+type Client struct {
+	*sql.DB
+	Driver  string
+	primary *Client       // レプリカの場合の参照先マスター
+	tracker *writeTracker // マスターの場合の書き込み履歴
+}
+
+// 接続確認のタイムアウトが設定されていない場合の既定値
+const defaultDialTimeout = 5 * time.Second
+
+// New は設定の driver に応じたデータベースに接続します。指定がない場合はMySQL
+func New(config *config.DB) (*Client, error) {
+	switch config.Driver {
+	case "", DriverMySQL:
+		return NewMySQL(config)
+	case DriverPostgres:
+		return NewPostgres(config)
+	case DriverSQLite:
+		return NewSQLite(config)
+	default:
+		return nil, fmt.Errorf("unknown db driver: %v", config.Driver)
+	}
+}
+
+func dialTimeout(config *config.DB) time.Duration {
+	if config.DialTimeoutSeconds > 0 {
+		return time.Duration(config.DialTimeoutSeconds) * time.Second
+	}
+	return defaultDialTimeout
+}
+
+// open はコネクションプールを設定し、接続できることを確認します
+func open(driver, driverName, dsn string, config *config.DB) (*Client, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(config.ConnMaxLifetimeSeconds) * time.Second)
+
+	// 起動時に接続できることを確認しておく
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout(config))
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Client{DB: db, Driver: driver}, nil
+}
+
+// SetPrimary はレプリカにマスターを紐付け、必要な場合に読み込みをマスターへ切り替えられるようにします
+func (c *Client) SetPrimary(primary *Client) {
+	if c != primary {
+		c.primary = primary
+	}
+}
+
+// Primary はレプリカに紐付いたマスターを返します。マスターまたは単一構成の場合はnil
+func (c *Client) Primary() *Client {
+	return c.primary
+}
+
+// TrackWrites は書き込み後 window の間、同じユーザーの読み込みをマスターへ向けるようにします
+func (c *Client) TrackWrites(window time.Duration) {
+	if window <= 0 {
+		c.tracker = nil
+		return
+	}
+	c.tracker = &writeTracker{
+		window: window,
+		writes: map[string]time.Time{},
+	}
+}
+
+// MarkWrite はユーザーの書き込みを記録します
+func (c *Client) MarkWrite(actor string) {
+	if c.tracker != nil && actor != "" {
+		c.tracker.mark(actor)
+	}
+}
+
+// WroteRecently はユーザーが直近に書き込みを行ったかどうかを返します
+func (c *Client) WroteRecently(actor string) bool {
+	return c.tracker != nil && actor != "" && c.tracker.recent(actor)
+}
+
+func (c *Client) Close() error {
+	return c.DB.Close()
+}
+
+// QuoteIdent はテーブル名やデータベース名をSQL中で使えるようにクォートします
+func (c *Client) QuoteIdent(name string) string {
+	if c.Driver == DriverPostgres || c.Driver == DriverSQLite {
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// ReplicaLag はレプリケーションの遅延秒数を返します
+// レプリカでない場合やレプリケーションが停止している場合はnilを返します
+func (c *Client) ReplicaLag(ctx context.Context) (*int, error) {
+	switch c.Driver {
+	case DriverPostgres:
+		return c.postgresReplicaLag(ctx)
+	case DriverSQLite:
+		// 同じファイルを読み書きするためレプリカは存在しない
+		return nil, nil
+	default:
+		return c.mysqlReplicaLag(ctx)
+	}
+}
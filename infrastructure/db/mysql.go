@@ -1,17 +1,15 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"strconv"
 
 	"github.com/mochisuna/linebot-sample/config"
 
 	"github.com/go-sql-driver/mysql"
 )
 
-type Client struct {
-	*sql.DB
-}
-
 func NewMySQL(config *config.DB) (*Client, error) {
 	conf := &mysql.Config{
 		User:                 config.User,
@@ -21,14 +19,42 @@ func NewMySQL(config *config.DB) (*Client, error) {
 		DBName:               config.DBName,
 		ParseTime:            true,
 		AllowNativePasswords: true,
+		Timeout:              dialTimeout(config),
 	}
-	db, err := sql.Open("mysql", conf.FormatDSN())
+	return open(DriverMySQL, "mysql", conf.FormatDSN(), config)
+}
+
+// mysqlReplicaLag は SHOW SLAVE STATUS からレプリケーションの遅延秒数を返します
+func (c *Client) mysqlReplicaLag(ctx context.Context) (*int, error) {
+	rows, err := c.DB.QueryContext(ctx, "SHOW SLAVE STATUS")
 	if err != nil {
 		return nil, err
 	}
-	return &Client{db}, nil
-}
-
-func (c *Client) Close() {
-	c.Close()
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" || !values[i].Valid {
+			continue
+		}
+		lag, err := strconv.Atoi(values[i].String)
+		if err != nil {
+			return nil, err
+		}
+		return &lag, nil
+	}
+	return nil, nil
 }
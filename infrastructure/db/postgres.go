@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+
+	"github.com/mochisuna/linebot-sample/config"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func NewPostgres(config *config.DB) (*Client, error) {
+	query := url.Values{}
+	query.Set("connect_timeout", strconv.Itoa(int(dialTimeout(config).Seconds())))
+	dsn := &url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(config.User, config.Password),
+		Host:     config.Host + config.Port,
+		Path:     "/" + config.DBName,
+		RawQuery: query.Encode(),
+	}
+	return open(DriverPostgres, "pgx", dsn.String(), config)
+}
+
+// postgresReplicaLag は最後に反映したトランザクションからの経過秒数を返します
+func (c *Client) postgresReplicaLag(ctx context.Context) (*int, error) {
+	var lag sql.NullInt64
+	err := c.DB.QueryRowContext(ctx,
+		"SELECT CASE WHEN pg_is_in_recovery() THEN EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())::int END",
+	).Scan(&lag)
+	if err != nil || !lag.Valid {
+		return nil, err
+	}
+	ret := int(lag.Int64)
+	return &ret, nil
+}
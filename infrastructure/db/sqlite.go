@@ -0,0 +1,27 @@
+package db
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/mochisuna/linebot-sample/config"
+
+	_ "modernc.org/sqlite"
+)
+
+// NewSQLite はファイルに保存するSQLiteを開きます
+// 書き込みが競合しないよう接続は1本に絞り、全ての読み書きをこの接続で直列に処理します
+func NewSQLite(config *config.DB) (*Client, error) {
+	query := url.Values{}
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", "synchronous(NORMAL)")
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout("+strconv.Itoa(int(dialTimeout(config).Milliseconds()))+")")
+	query.Set("_txlock", "immediate")
+	dsn := "file:" + config.Path + "?" + query.Encode()
+
+	single := *config
+	single.MaxOpenConns = 1
+	single.MaxIdleConns = 1
+	return open(DriverSQLite, "sqlite", dsn, &single)
+}
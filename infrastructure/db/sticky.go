@@ -0,0 +1,38 @@
+package db
+
+import (
+	"sync"
+	"time"
+)
+
+// writeTracker はユーザーごとの最終書き込み時刻を保持します
+// 書き込み直後の読み込みをマスターに向け、レプリカ遅延で古いデータを読まないようにするために使います
+type writeTracker struct {
+	window time.Duration
+	mu     sync.Mutex
+	writes map[string]time.Time
+}
+
+// 期限切れのエントリを掃除する間隔
+const trackerCleanupSize = 1024
+
+func (t *writeTracker) mark(actor string) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.writes) >= trackerCleanupSize {
+		for k, v := range t.writes {
+			if now.Sub(v) > t.window {
+				delete(t.writes, k)
+			}
+		}
+	}
+	t.writes[actor] = now
+}
+
+func (t *writeTracker) recent(actor string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	at, ok := t.writes[actor]
+	return ok && time.Since(at) <= t.window
+}
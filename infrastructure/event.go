@@ -2,13 +2,12 @@ package infrastructure
 
 import (
 	"context"
-	"database/sql"
-	"log"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/mochisuna/linebot-sample/domain"
 	"github.com/mochisuna/linebot-sample/domain/repository"
 	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/logger"
 )
 
 type eventRepository struct {
@@ -23,66 +22,66 @@ func NewEventRepository(dbmClient *db.Client, dbsClient *db.Client) repository.E
 	}
 }
 
-// TODO 共通化
-func (r *eventRepository) WithTransaction(ctx context.Context, txFunc func(*sql.Tx) error) error {
-	tx, err := r.dbm.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if p := recover(); p != nil {
-			tx.Rollback()
-			panic(p) // re-throw panic after Rollback
-		} else if err != nil {
-			tx.Rollback()
-		} else {
-			err = tx.Commit()
+func (r *eventRepository) Create(ctx context.Context, event *domain.Event) error {
+	logger.FromContext(ctx).Debug("called infrastructure.event Create")
+	// 複数テーブルへの登録なので呼び出し元がトランザクション外でも必ずまとめてコミットする
+	return withTx(ctx, r.dbm, func(ctx context.Context) error {
+		_, err := squirrel.Insert(EVENTS).
+			Columns("event_id", "created_at", "updated_at").
+			Values(event.ID, event.CreatedAt, event.UpdatedAt).
+			RunWith(runner(ctx, r.dbm)).
+			ExecContext(ctx)
+		if err != nil {
+			return err
 		}
-	}()
-	err = txFunc(tx)
-	return err
-}
-
-func (r *eventRepository) Create(event *domain.Event, tx *sql.Tx) error {
-	log.Println("called infrastructure.event Create")
-	_, err := squirrel.Insert(EVENTS).
-		Columns("event_id", "created_at", "updated_at").
-		Values(event.ID, event.CreatedAt, event.UpdatedAt).
-		RunWith(tx).
-		Exec()
-	if err != nil {
-		return err
-	}
-	_, err = squirrel.Insert(EVENT_STATUSES).
-		Columns("event_id", "owner_id", "status", "created_at", "updated_at").
-		Values(event.ID, event.OwnerID, event.Status, event.CreatedAt, event.UpdatedAt).
-		RunWith(tx).
-		Exec()
-	if err != nil {
-		return err
-	}
-	return nil
+		_, err = squirrel.Insert(EVENT_STATUSES).
+			Columns("event_id", "owner_id", "status", "title", "join_code", "is_private", "passcode", "is_voting", "vote_closes_at", "vote_opened_at", "vote_policy", "opened_at", "created_at", "updated_at").
+			Values(event.ID, event.OwnerID, event.Status, event.Title, event.JoinCode, event.IsPrivate, event.Passcode, event.IsVoting, event.VoteClosesAt, event.VoteOpenedAt, event.VotePolicy, event.OpenedAt, event.CreatedAt, event.UpdatedAt).
+			RunWith(runner(ctx, r.dbm)).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		// 権限判定は主催者テーブルで行うので作成者も主催者として登録しておく
+		_, err = squirrel.Insert(EVENT_ORGANIZERS).
+			Columns("event_id", "owner_id", "role", "created_at", "updated_at").
+			Values(event.ID, event.OwnerID, domain.ORGANIZER_PRIMARY, event.CreatedAt, event.UpdatedAt).
+			RunWith(runner(ctx, r.dbm)).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
 }
 
-func (r *eventRepository) Update(event *domain.Event, tx *sql.Tx) error {
-	log.Println("called infrastructure.event Update")
+func (r *eventRepository) Update(ctx context.Context, event *domain.Event) error {
+	logger.FromContext(ctx).Debug("called infrastructure.event Update")
 	_, err := squirrel.Update(EVENT_STATUSES).
 		SetMap(squirrel.Eq{
-			"status":     event.Status,
-			"updated_at": event.UpdatedAt,
+			"status":         event.Status,
+			"title":          event.Title,
+			"is_private":     event.IsPrivate,
+			"passcode":       event.Passcode,
+			"is_voting":      event.IsVoting,
+			"vote_closes_at": event.VoteClosesAt,
+			"vote_opened_at": event.VoteOpenedAt,
+			"vote_policy":    event.VotePolicy,
+			"opened_at":      event.OpenedAt,
+			"updated_at":     event.UpdatedAt,
 		}).
 		Where(squirrel.Eq{
-			"owner_id": event.OwnerID,
+			"event_id": event.ID,
 		}).
 		Where(squirrel.NotEq{
 			"status": domain.EVENT_CLOSED,
 		}).
-		RunWith(tx).
-		Exec()
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
 	return err
 }
-func (r *eventRepository) SelectByOwnerID(ownerID domain.OwnerID, status *domain.EventStatus) (*domain.Event, error) {
-	log.Println("called infrastructure.event SelectByOwnerID")
+func (r *eventRepository) SelectByOwnerID(ctx context.Context, ownerID domain.OwnerID, status *domain.EventStatus) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.event SelectByOwnerID")
 	var col eventStatusColumns
 	param := squirrel.Eq{
 		"owner_id": ownerID,
@@ -93,90 +92,323 @@ func (r *eventRepository) SelectByOwnerID(ownerID domain.OwnerID, status *domain
 			"status":   *status,
 		}
 	}
-	err := squirrel.Select("event_id", "owner_id", "status", "created_at", "updated_at").
+	err := squirrel.Select("event_id", "owner_id", "status", "title", "join_code", "is_private", "passcode", "is_voting", "vote_closes_at", "vote_opened_at", "vote_policy", "opened_at", "created_at", "updated_at").
 		From(EVENT_STATUSES).
 		Where(param).
 		Where(squirrel.NotEq{
 			"status": domain.EVENT_CLOSED,
 		}).
-		RunWith(r.dbs.DB).
-		QueryRow().
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
 		Scan(
 			&col.EventID,
 			&col.OwnerID,
 			&col.Status,
+			&col.Title,
+			&col.JoinCode,
+			&col.IsPrivate,
+			&col.Passcode,
+			&col.IsVoting,
+			&col.VoteClosesAt,
+			&col.VoteOpenedAt,
+			&col.VotePolicy,
+			&col.OpenedAt,
 			&col.CreatedAt,
 			&col.UpdatedAt,
 		)
 	return &domain.Event{
-		ID:        col.EventID,
-		OwnerID:   col.OwnerID,
-		Status:    col.Status,
-		CreatedAt: col.CreatedAt,
-		UpdatedAt: col.UpdatedAt,
+		ID:           col.EventID,
+		OwnerID:      col.OwnerID,
+		Status:       col.Status,
+		Title:        col.Title,
+		JoinCode:     col.JoinCode.String,
+		IsPrivate:    col.IsPrivate,
+		Passcode:     col.Passcode.String,
+		IsVoting:     col.IsVoting,
+		VoteClosesAt: col.VoteClosesAt,
+		VoteOpenedAt: col.VoteOpenedAt,
+		VotePolicy:   col.VotePolicy,
+		OpenedAt:     col.OpenedAt,
+		CreatedAt:    col.CreatedAt,
+		UpdatedAt:    col.UpdatedAt,
 	}, err
 }
 
-// TODO Select関数として統合
-func (r *eventRepository) SelectByEventID(eventID domain.EventID) (*domain.Event, error) {
-	log.Println("called infrastructure.event SelectByEventID")
+// SelectByOrganizerID は共同主催者を含む主催者のIDからイベントを取得します
+func (r *eventRepository) SelectByOrganizerID(ctx context.Context, ownerID domain.OwnerID, status *domain.EventStatus) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.event SelectByOrganizerID")
 	var col eventStatusColumns
-	err := squirrel.Select("event_id", "owner_id", "status", "created_at", "updated_at").
+	param := squirrel.Eq{
+		"eo.owner_id": ownerID,
+	}
+	if status != nil {
+		param = squirrel.Eq{
+			"eo.owner_id": ownerID,
+			"es.status":   *status,
+		}
+	}
+	err := squirrel.Select("es.event_id", "es.owner_id", "es.status", "es.title", "es.join_code", "es.is_private", "es.passcode", "es.is_voting", "es.vote_closes_at", "es.vote_opened_at", "es.vote_policy", "es.opened_at", "es.created_at", "es.updated_at").
+		From(EVENT_STATUSES+" AS es").
+		Join(EVENT_ORGANIZERS+" AS eo ON eo.event_id = es.event_id").
+		Where(param).
+		Where(squirrel.NotEq{
+			"es.status": domain.EVENT_CLOSED,
+		}).
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
+		Scan(
+			&col.EventID,
+			&col.OwnerID,
+			&col.Status,
+			&col.Title,
+			&col.JoinCode,
+			&col.IsPrivate,
+			&col.Passcode,
+			&col.IsVoting,
+			&col.VoteClosesAt,
+			&col.VoteOpenedAt,
+			&col.VotePolicy,
+			&col.OpenedAt,
+			&col.CreatedAt,
+			&col.UpdatedAt,
+		)
+	return &domain.Event{
+		ID:           col.EventID,
+		OwnerID:      col.OwnerID,
+		Status:       col.Status,
+		Title:        col.Title,
+		JoinCode:     col.JoinCode.String,
+		IsPrivate:    col.IsPrivate,
+		Passcode:     col.Passcode.String,
+		IsVoting:     col.IsVoting,
+		VoteClosesAt: col.VoteClosesAt,
+		VoteOpenedAt: col.VoteOpenedAt,
+		VotePolicy:   col.VotePolicy,
+		OpenedAt:     col.OpenedAt,
+		CreatedAt:    col.CreatedAt,
+		UpdatedAt:    col.UpdatedAt,
+	}, err
+}
+
+// SelectByJoinCode は終了していないイベントを参加コードから取得します
+func (r *eventRepository) SelectByJoinCode(ctx context.Context, code string) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.event SelectByJoinCode")
+	var col eventStatusColumns
+	err := squirrel.Select("event_id", "owner_id", "status", "title", "join_code", "is_private", "passcode", "is_voting", "vote_closes_at", "vote_opened_at", "vote_policy", "opened_at", "created_at", "updated_at").
 		From(EVENT_STATUSES).
 		Where(squirrel.Eq{
-			"event_id": eventID,
+			"join_code": code,
 		}).
-		RunWith(r.dbs.DB).
-		QueryRow().
+		Where(squirrel.NotEq{
+			"status": domain.EVENT_CLOSED,
+		}).
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
 		Scan(
 			&col.EventID,
 			&col.OwnerID,
 			&col.Status,
+			&col.Title,
+			&col.JoinCode,
+			&col.IsPrivate,
+			&col.Passcode,
+			&col.IsVoting,
+			&col.VoteClosesAt,
+			&col.VoteOpenedAt,
+			&col.VotePolicy,
+			&col.OpenedAt,
 			&col.CreatedAt,
 			&col.UpdatedAt,
 		)
 	return &domain.Event{
-		ID:        col.EventID,
-		OwnerID:   col.OwnerID,
-		Status:    col.Status,
-		CreatedAt: col.CreatedAt,
-		UpdatedAt: col.UpdatedAt,
+		ID:           col.EventID,
+		OwnerID:      col.OwnerID,
+		Status:       col.Status,
+		Title:        col.Title,
+		JoinCode:     col.JoinCode.String,
+		IsPrivate:    col.IsPrivate,
+		Passcode:     col.Passcode.String,
+		IsVoting:     col.IsVoting,
+		VoteClosesAt: col.VoteClosesAt,
+		VoteOpenedAt: col.VoteOpenedAt,
+		VotePolicy:   col.VotePolicy,
+		OpenedAt:     col.OpenedAt,
+		CreatedAt:    col.CreatedAt,
+		UpdatedAt:    col.UpdatedAt,
 	}, err
 }
 
-func (r *eventRepository) SelectList(status *domain.EventStatus) ([]domain.Event, error) {
-	log.Println("called infrastructure.event SelectList")
-	var ret []domain.Event
-	rows, err := squirrel.Select("event_id", "owner_id", "status", "created_at", "updated_at").
+// TODO Select関数として統合
+func (r *eventRepository) SelectByEventID(ctx context.Context, eventID domain.EventID) (*domain.Event, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.event SelectByEventID")
+	var col eventStatusColumns
+	err := squirrel.Select("event_id", "owner_id", "status", "title", "join_code", "is_private", "passcode", "is_voting", "vote_closes_at", "vote_opened_at", "vote_policy", "opened_at", "created_at", "updated_at").
 		From(EVENT_STATUSES).
 		Where(squirrel.Eq{
-			"status": *status,
+			"event_id": eventID,
 		}).
-		RunWith(r.dbs.DB).
-		Query()
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
+		Scan(
+			&col.EventID,
+			&col.OwnerID,
+			&col.Status,
+			&col.Title,
+			&col.JoinCode,
+			&col.IsPrivate,
+			&col.Passcode,
+			&col.IsVoting,
+			&col.VoteClosesAt,
+			&col.VoteOpenedAt,
+			&col.VotePolicy,
+			&col.OpenedAt,
+			&col.CreatedAt,
+			&col.UpdatedAt,
+		)
+	return &domain.Event{
+		ID:           col.EventID,
+		OwnerID:      col.OwnerID,
+		Status:       col.Status,
+		Title:        col.Title,
+		JoinCode:     col.JoinCode.String,
+		IsPrivate:    col.IsPrivate,
+		Passcode:     col.Passcode.String,
+		IsVoting:     col.IsVoting,
+		VoteClosesAt: col.VoteClosesAt,
+		VoteOpenedAt: col.VoteOpenedAt,
+		VotePolicy:   col.VotePolicy,
+		OpenedAt:     col.OpenedAt,
+		CreatedAt:    col.CreatedAt,
+		UpdatedAt:    col.UpdatedAt,
+	}, err
+}
+
+// SelectList は条件に一致するイベントを主催者名と参加者数付きで返します
+func (r *eventRepository) SelectList(ctx context.Context, query *domain.EventListQuery) ([]domain.EventSummary, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.event SelectList")
+	var ret []domain.EventSummary
+	builder := squirrel.Select(
+		"es.event_id", "es.owner_id", "es.status", "es.title", "es.join_code", "es.is_private", "es.passcode", "es.is_voting", "es.vote_closes_at", "es.vote_opened_at", "es.vote_policy", "es.opened_at", "es.created_at", "es.updated_at",
+		"COALESCE(o.display_name, '')", "COUNT(ep.user_id)",
+	).
+		From(EVENT_STATUSES+" AS es").
+		LeftJoin(OWNERS+" AS o ON o.owner_id = es.owner_id").
+		LeftJoin(EVENT_PARTICIPANTS+" AS ep ON ep.event_id = es.event_id AND ep.is_participated = ?", true).
+		GroupBy("es.owner_id", "es.event_id", "o.display_name")
+	if query.Status != nil {
+		builder = builder.Where(squirrel.Eq{
+			"es.status": *query.Status,
+		})
+	}
+	if !query.IncludePrivate {
+		builder = builder.Where(squirrel.Eq{
+			"es.is_private": false,
+		})
+	}
+	switch query.Order {
+	case domain.EVENT_ORDER_OLDEST:
+		builder = builder.OrderBy("es.created_at ASC", "es.event_id ASC")
+	case domain.EVENT_ORDER_PARTICIPANTS:
+		builder = builder.OrderBy("COUNT(ep.user_id) DESC", "es.created_at DESC", "es.event_id ASC")
+	default:
+		builder = builder.OrderBy("es.created_at DESC", "es.event_id ASC")
+	}
+	if query.Limit > 0 {
+		builder = builder.Limit(uint64(query.Limit)).Offset(uint64(query.Offset))
+	}
+
+	rows, err := builder.RunWith(runner(ctx, r.dbs)).QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var eventStatus eventStatusColumns
+		var summary domain.EventSummary
 		err = rows.Scan(
 			&eventStatus.EventID,
 			&eventStatus.OwnerID,
 			&eventStatus.Status,
+			&eventStatus.Title,
+			&eventStatus.JoinCode,
+			&eventStatus.IsPrivate,
+			&eventStatus.Passcode,
+			&eventStatus.IsVoting,
+			&eventStatus.VoteClosesAt,
+			&eventStatus.VoteOpenedAt,
+			&eventStatus.VotePolicy,
+			&eventStatus.OpenedAt,
 			&eventStatus.CreatedAt,
 			&eventStatus.UpdatedAt,
+			&summary.OwnerName,
+			&summary.ParticipantCount,
 		)
 		if err != nil {
 			return nil, err
 		}
-		ret = append(ret, domain.Event{
-			ID:        eventStatus.EventID,
-			OwnerID:   eventStatus.OwnerID,
-			Status:    eventStatus.Status,
-			CreatedAt: eventStatus.CreatedAt,
-			UpdatedAt: eventStatus.UpdatedAt,
-		})
+		summary.Event = domain.Event{
+			ID:           eventStatus.EventID,
+			OwnerID:      eventStatus.OwnerID,
+			Status:       eventStatus.Status,
+			Title:        eventStatus.Title,
+			JoinCode:     eventStatus.JoinCode.String,
+			IsPrivate:    eventStatus.IsPrivate,
+			Passcode:     eventStatus.Passcode.String,
+			IsVoting:     eventStatus.IsVoting,
+			VoteClosesAt: eventStatus.VoteClosesAt,
+			VoteOpenedAt: eventStatus.VoteOpenedAt,
+			VotePolicy:   eventStatus.VotePolicy,
+			OpenedAt:     eventStatus.OpenedAt,
+			CreatedAt:    eventStatus.CreatedAt,
+			UpdatedAt:    eventStatus.UpdatedAt,
+		}
+		ret = append(ret, summary)
 	}
 
-	return ret, err
+	return ret, rows.Err()
+}
+
+// CountPasscodeFailures は指定時刻以降のパスコード入力失敗回数を返します
+// 連続した試行をレプリカ遅延で取りこぼさないようマスターから参照する
+func (r *eventRepository) CountPasscodeFailures(ctx context.Context, eventID domain.EventID, userID domain.UserID, since int) (int, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.event CountPasscodeFailures")
+	var count int
+	err := squirrel.Select("COUNT(*)").
+		From(PASSCODE_FAILURES).
+		Where(squirrel.Eq{
+			"event_id": eventID,
+			"user_id":  userID,
+		}).
+		Where(squirrel.GtOrEq{
+			"created_at": since,
+		}).
+		RunWith(runner(ctx, r.dbm)).
+		QueryRowContext(ctx).
+		Scan(&count)
+	return count, err
+}
+
+func (r *eventRepository) CreatePasscodeFailure(ctx context.Context, eventID domain.EventID, userID domain.UserID, now int) error {
+	logger.FromContext(ctx).Debug("called infrastructure.event CreatePasscodeFailure")
+	_, err := squirrel.Insert(PASSCODE_FAILURES).
+		Columns("event_id", "user_id", "created_at").
+		Values(eventID, userID, now).
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
+	return err
+}
+
+// CountByStatus は指定した状態のイベント数を返します
+func (r *eventRepository) CountByStatus(ctx context.Context, status domain.EventStatus) (int, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.event CountByStatus")
+	var count int
+	err := squirrel.Select("COUNT(*)").
+		From(EVENT_STATUSES).
+		Where(squirrel.Eq{
+			"status": status,
+		}).
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
+		Scan(&count)
+	return count, err
 }
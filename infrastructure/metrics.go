@@ -0,0 +1,252 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/metrics"
+)
+
+// observe はリポジトリのメソッドの処理時間とエラーを記録します
+// 該当なしや一意制約による重複は想定内の結果のためエラーとして数えない
+func observe(repo, method string, start time.Time, err *error) {
+	metrics.DBQueryDuration.WithLabelValues(repo, method).Observe(time.Since(start).Seconds())
+	switch *err {
+	case nil, sql.ErrNoRows, domain.ErrAlreadyParticipated, domain.ErrAlreadyParticipating:
+		return
+	}
+	metrics.DBQueryErrors.WithLabelValues(repo, method).Inc()
+}
+
+type instrumentedEventRepository struct {
+	repo repository.EventRepository
+}
+
+// InstrumentEventRepository はメソッドごとの処理時間とエラーを記録するリポジトリを返します
+func InstrumentEventRepository(repo repository.EventRepository) repository.EventRepository {
+	return &instrumentedEventRepository{repo: repo}
+}
+
+func (r *instrumentedEventRepository) SelectByOwnerID(ctx context.Context, ownerID domain.OwnerID, status *domain.EventStatus) (_ *domain.Event, err error) {
+	defer observe("event", "SelectByOwnerID", time.Now(), &err)
+	return r.repo.SelectByOwnerID(ctx, ownerID, status)
+}
+
+func (r *instrumentedEventRepository) SelectByOrganizerID(ctx context.Context, ownerID domain.OwnerID, status *domain.EventStatus) (_ *domain.Event, err error) {
+	defer observe("event", "SelectByOrganizerID", time.Now(), &err)
+	return r.repo.SelectByOrganizerID(ctx, ownerID, status)
+}
+
+func (r *instrumentedEventRepository) SelectByEventID(ctx context.Context, eventID domain.EventID) (_ *domain.Event, err error) {
+	defer observe("event", "SelectByEventID", time.Now(), &err)
+	return r.repo.SelectByEventID(ctx, eventID)
+}
+
+func (r *instrumentedEventRepository) SelectByJoinCode(ctx context.Context, code string) (_ *domain.Event, err error) {
+	defer observe("event", "SelectByJoinCode", time.Now(), &err)
+	return r.repo.SelectByJoinCode(ctx, code)
+}
+
+func (r *instrumentedEventRepository) SelectList(ctx context.Context, query *domain.EventListQuery) (_ []domain.EventSummary, err error) {
+	defer observe("event", "SelectList", time.Now(), &err)
+	return r.repo.SelectList(ctx, query)
+}
+
+func (r *instrumentedEventRepository) Update(ctx context.Context, event *domain.Event) (err error) {
+	defer observe("event", "Update", time.Now(), &err)
+	return r.repo.Update(ctx, event)
+}
+
+func (r *instrumentedEventRepository) Create(ctx context.Context, event *domain.Event) (err error) {
+	defer observe("event", "Create", time.Now(), &err)
+	return r.repo.Create(ctx, event)
+}
+
+func (r *instrumentedEventRepository) CountPasscodeFailures(ctx context.Context, eventID domain.EventID, userID domain.UserID, since int) (_ int, err error) {
+	defer observe("event", "CountPasscodeFailures", time.Now(), &err)
+	return r.repo.CountPasscodeFailures(ctx, eventID, userID, since)
+}
+
+func (r *instrumentedEventRepository) CreatePasscodeFailure(ctx context.Context, eventID domain.EventID, userID domain.UserID, now int) (err error) {
+	defer observe("event", "CreatePasscodeFailure", time.Now(), &err)
+	return r.repo.CreatePasscodeFailure(ctx, eventID, userID, now)
+}
+
+func (r *instrumentedEventRepository) CountByStatus(ctx context.Context, status domain.EventStatus) (_ int, err error) {
+	defer observe("event", "CountByStatus", time.Now(), &err)
+	return r.repo.CountByStatus(ctx, status)
+}
+
+type instrumentedOwnerRepository struct {
+	repo repository.OwnerRepository
+}
+
+// InstrumentOwnerRepository はメソッドごとの処理時間とエラーを記録するリポジトリを返します
+func InstrumentOwnerRepository(repo repository.OwnerRepository) repository.OwnerRepository {
+	return &instrumentedOwnerRepository{repo: repo}
+}
+
+func (r *instrumentedOwnerRepository) Select(ctx context.Context, ownerID domain.OwnerID) (_ *domain.Owner, err error) {
+	defer observe("owner", "Select", time.Now(), &err)
+	return r.repo.Select(ctx, ownerID)
+}
+
+func (r *instrumentedOwnerRepository) Create(ctx context.Context, owner *domain.Owner) (err error) {
+	defer observe("owner", "Create", time.Now(), &err)
+	return r.repo.Create(ctx, owner)
+}
+
+func (r *instrumentedOwnerRepository) Update(ctx context.Context, owner *domain.Owner) (err error) {
+	defer observe("owner", "Update", time.Now(), &err)
+	return r.repo.Update(ctx, owner)
+}
+
+type instrumentedUserRepository struct {
+	repo repository.UserRepository
+}
+
+// InstrumentUserRepository はメソッドごとの処理時間とエラーを記録するリポジトリを返します
+func InstrumentUserRepository(repo repository.UserRepository) repository.UserRepository {
+	return &instrumentedUserRepository{repo: repo}
+}
+
+func (r *instrumentedUserRepository) Select(ctx context.Context, userID *domain.UserID, eventID *domain.EventID) (_ *domain.User, err error) {
+	defer observe("user", "Select", time.Now(), &err)
+	return r.repo.Select(ctx, userID, eventID)
+}
+
+func (r *instrumentedUserRepository) SelectByIDAndStatus(ctx context.Context, userID *domain.UserID, isParticipated bool) (_ *domain.User, err error) {
+	defer observe("user", "SelectByIDAndStatus", time.Now(), &err)
+	return r.repo.SelectByIDAndStatus(ctx, userID, isParticipated)
+}
+
+func (r *instrumentedUserRepository) SelectContext(ctx context.Context, userID domain.UserID) (_ *domain.UserContext, err error) {
+	defer observe("user", "SelectContext", time.Now(), &err)
+	return r.repo.SelectContext(ctx, userID)
+}
+
+func (r *instrumentedUserRepository) Update(ctx context.Context, user *domain.User) (err error) {
+	defer observe("user", "Update", time.Now(), &err)
+	return r.repo.Update(ctx, user)
+}
+
+func (r *instrumentedUserRepository) LeaveByEventID(ctx context.Context, eventID domain.EventID, updatedAt int) (err error) {
+	defer observe("user", "LeaveByEventID", time.Now(), &err)
+	return r.repo.LeaveByEventID(ctx, eventID, updatedAt)
+}
+
+func (r *instrumentedUserRepository) Participate(ctx context.Context, user *domain.User) (err error) {
+	defer observe("user", "Participate", time.Now(), &err)
+	return r.repo.Participate(ctx, user)
+}
+
+func (r *instrumentedUserRepository) Vote(ctx context.Context, user *domain.User) (err error) {
+	defer observe("user", "Vote", time.Now(), &err)
+	return r.repo.Vote(ctx, user)
+}
+
+func (r *instrumentedUserRepository) SelectVote(ctx context.Context, userID *domain.UserID, eventID *domain.EventID) (_ *domain.User, err error) {
+	defer observe("user", "SelectVote", time.Now(), &err)
+	return r.repo.SelectVote(ctx, userID, eventID)
+}
+
+func (r *instrumentedUserRepository) CreateVoteHistory(ctx context.Context, history *domain.VoteHistory) (err error) {
+	defer observe("user", "CreateVoteHistory", time.Now(), &err)
+	return r.repo.CreateVoteHistory(ctx, history)
+}
+
+func (r *instrumentedUserRepository) SelectVoteHistories(ctx context.Context, eventID domain.EventID) (_ []domain.VoteHistory, err error) {
+	defer observe("user", "SelectVoteHistories", time.Now(), &err)
+	return r.repo.SelectVoteHistories(ctx, eventID)
+}
+
+func (r *instrumentedUserRepository) SelectVotes(ctx context.Context, eventID domain.EventID) (_ []domain.User, err error) {
+	defer observe("user", "SelectVotes", time.Now(), &err)
+	return r.repo.SelectVotes(ctx, eventID)
+}
+
+func (r *instrumentedUserRepository) SelectParticipants(ctx context.Context, eventID domain.EventID) (_ []domain.User, err error) {
+	defer observe("user", "SelectParticipants", time.Now(), &err)
+	return r.repo.SelectParticipants(ctx, eventID)
+}
+
+func (r *instrumentedUserRepository) CountParticipants(ctx context.Context) (_ int, err error) {
+	defer observe("user", "CountParticipants", time.Now(), &err)
+	return r.repo.CountParticipants(ctx)
+}
+
+func (r *instrumentedUserRepository) SelectParticipantIDs(ctx context.Context, eventID domain.EventID) (_ []domain.UserID, err error) {
+	defer observe("user", "SelectParticipantIDs", time.Now(), &err)
+	return r.repo.SelectParticipantIDs(ctx, eventID)
+}
+
+type instrumentedOrganizerRepository struct {
+	repo repository.OrganizerRepository
+}
+
+// InstrumentOrganizerRepository はメソッドごとの処理時間とエラーを記録するリポジトリを返します
+func InstrumentOrganizerRepository(repo repository.OrganizerRepository) repository.OrganizerRepository {
+	return &instrumentedOrganizerRepository{repo: repo}
+}
+
+func (r *instrumentedOrganizerRepository) Select(ctx context.Context, eventID domain.EventID, ownerID domain.OwnerID) (_ *domain.Organizer, err error) {
+	defer observe("organizer", "Select", time.Now(), &err)
+	return r.repo.Select(ctx, eventID, ownerID)
+}
+
+func (r *instrumentedOrganizerRepository) SelectList(ctx context.Context, eventID domain.EventID) (_ []domain.Organizer, err error) {
+	defer observe("organizer", "SelectList", time.Now(), &err)
+	return r.repo.SelectList(ctx, eventID)
+}
+
+func (r *instrumentedOrganizerRepository) SelectInvitation(ctx context.Context, code string) (_ *domain.Invitation, err error) {
+	defer observe("organizer", "SelectInvitation", time.Now(), &err)
+	return r.repo.SelectInvitation(ctx, code)
+}
+
+func (r *instrumentedOrganizerRepository) SelectInvitationByEventID(ctx context.Context, eventID domain.EventID) (_ *domain.Invitation, err error) {
+	defer observe("organizer", "SelectInvitationByEventID", time.Now(), &err)
+	return r.repo.SelectInvitationByEventID(ctx, eventID)
+}
+
+func (r *instrumentedOrganizerRepository) Create(ctx context.Context, organizer *domain.Organizer) (err error) {
+	defer observe("organizer", "Create", time.Now(), &err)
+	return r.repo.Create(ctx, organizer)
+}
+
+func (r *instrumentedOrganizerRepository) Delete(ctx context.Context, organizer *domain.Organizer) (err error) {
+	defer observe("organizer", "Delete", time.Now(), &err)
+	return r.repo.Delete(ctx, organizer)
+}
+
+func (r *instrumentedOrganizerRepository) CreateInvitation(ctx context.Context, invitation *domain.Invitation) (err error) {
+	defer observe("organizer", "CreateInvitation", time.Now(), &err)
+	return r.repo.CreateInvitation(ctx, invitation)
+}
+
+func (r *instrumentedOrganizerRepository) DeleteInvitation(ctx context.Context, eventID domain.EventID) (err error) {
+	defer observe("organizer", "DeleteInvitation", time.Now(), &err)
+	return r.repo.DeleteInvitation(ctx, eventID)
+}
+
+type instrumentedCommentRepository struct {
+	repo repository.CommentRepository
+}
+
+// InstrumentCommentRepository はメソッドごとの処理時間とエラーを記録するリポジトリを返します
+func InstrumentCommentRepository(repo repository.CommentRepository) repository.CommentRepository {
+	return &instrumentedCommentRepository{repo: repo}
+}
+
+func (r *instrumentedCommentRepository) SelectByEventID(ctx context.Context, eventID domain.EventID) (_ []domain.Comment, err error) {
+	defer observe("comment", "SelectByEventID", time.Now(), &err)
+	return r.repo.SelectByEventID(ctx, eventID)
+}
+
+func (r *instrumentedCommentRepository) Create(ctx context.Context, comment *domain.Comment) (err error) {
+	defer observe("comment", "Create", time.Now(), &err)
+	return r.repo.Create(ctx, comment)
+}
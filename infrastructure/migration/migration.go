@@ -0,0 +1,521 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+)
+
+// SCHEMA_VERSIONS は適用済みのマイグレーションを記録するテーブル
+const SCHEMA_VERSIONS = "schema_versions"
+
+// LEGACY_SCHEMA_MIGRATIONS は以前 migrate コマンド (mattes/migrate) が使っていたテーブル (version, dirty)
+// 同じ番号のマイグレーションを引き継ぐため、初回に読み込んで適用済みとして記録する
+const LEGACY_SCHEMA_MIGRATIONS = "schema_migrations"
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// ファイル名は {version}_{name}.{up|down}.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration はバージョンごとのスキーマ変更
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum は適用後にファイルが書き換えられていないかの確認に使います
+func (m *Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// Status は各マイグレーションの適用状況
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt int
+	Modified  bool // 適用後にupファイルが変更されている
+}
+
+type Migrator struct {
+	db         *db.Client
+	builder    squirrel.StatementBuilderType
+	migrations []Migration
+}
+
+// New はバイナリに埋め込んだマイグレーションのうち、接続先のデータベース用のものを読み込みます
+func New(client *db.Client) (*Migrator, error) {
+	sub, err := fs.Sub(files, client.Driver)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := load(sub)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) < 1 {
+		return nil, fmt.Errorf("no migrations for %v", client.Driver)
+	}
+	return &Migrator{
+		db:         client,
+		builder:    statementBuilder(client),
+		migrations: migrations,
+	}, nil
+}
+
+func statementBuilder(client *db.Client) squirrel.StatementBuilderType {
+	if client.Driver == db.DriverPostgres {
+		return squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+	}
+	return squirrel.StatementBuilder
+}
+
+func load(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		matches := fileNamePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(matches[1])
+		body, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration %v has conflicting names: %v, %v", version, m.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	ret := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %v_%v must have both up and down files", m.Version, m.Name)
+		}
+		ret = append(ret, *m)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+	return ret, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	if m.db.Driver != db.DriverMySQL {
+		_, err := m.db.DB.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+SCHEMA_VERSIONS+" ("+
+			"version bigint NOT NULL, "+
+			"name varchar(255) NOT NULL, "+
+			"checksum char(64) NOT NULL, "+
+			"applied_at bigint NOT NULL, "+
+			"PRIMARY KEY (version)"+
+			")")
+		return err
+	}
+	_, err := m.db.DB.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `"+SCHEMA_VERSIONS+"` ("+
+		"`version` bigint(20) unsigned NOT NULL, "+
+		"`name` varchar(255) NOT NULL, "+
+		"`checksum` char(64) NOT NULL, "+
+		"`applied_at` bigint(20) unsigned NOT NULL, "+
+		"PRIMARY KEY (`version`)"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	return err
+}
+
+type appliedMigration struct {
+	Version   int
+	Checksum  string
+	AppliedAt int
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := m.builder.Select("version", "checksum", "applied_at").
+		From(SCHEMA_VERSIONS).
+		RunWith(m.db.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := map[int]appliedMigration{}
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.Version, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		ret[a.Version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return m.adoptLegacy(ctx)
+	}
+	return ret, nil
+}
+
+// adoptLegacy は以前のテーブルに記録されたバージョンまでを適用済みとして記録します
+// 以前のテーブルがない場合は何もしない
+func (m *Migrator) adoptLegacy(ctx context.Context) (map[int]appliedMigration, error) {
+	ret := map[int]appliedMigration{}
+	var version int
+	var dirty bool
+	err := m.builder.Select("version", "dirty").
+		From(LEGACY_SCHEMA_MIGRATIONS).
+		RunWith(m.db.DB).
+		QueryRowContext(ctx).
+		Scan(&version, &dirty)
+	if err != nil {
+		// テーブルがない、または空の場合は新しいデータベースとして扱う
+		return ret, nil
+	}
+	if dirty {
+		return nil, fmt.Errorf("%v is dirty at version %v; fix the schema and clear the dirty flag before migrating", LEGACY_SCHEMA_MIGRATIONS, version)
+	}
+	now := int(time.Now().Unix())
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		log.Printf("adopt %v: %v_%v", LEGACY_SCHEMA_MIGRATIONS, migration.Version, migration.Name)
+		_, err := m.builder.Insert(SCHEMA_VERSIONS).
+			Columns("version", "name", "checksum", "applied_at").
+			Values(migration.Version, migration.Name, migration.Checksum(), now).
+			RunWith(m.db.DB).
+			ExecContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ret[migration.Version] = appliedMigration{
+			Version:   migration.Version,
+			Checksum:  migration.Checksum(),
+			AppliedAt: now,
+		}
+	}
+	return ret, nil
+}
+
+// Status は埋め込まれている全マイグレーションの適用状況を返します
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		a, ok := applied[migration.Version]
+		ret = append(ret, Status{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   ok,
+			AppliedAt: a.AppliedAt,
+			Modified:  ok && a.Checksum != migration.Checksum(),
+		})
+	}
+	return ret, nil
+}
+
+// Up は未適用のマイグレーションを全て適用します
+func (m *Migrator) Up(ctx context.Context) error {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		log.Printf("migrate up: %v_%v", migration.Version, migration.Name)
+		record := m.builder.Insert(SCHEMA_VERSIONS).
+			Columns("version", "name", "checksum", "applied_at").
+			Values(migration.Version, migration.Name, migration.Checksum(), time.Now().Unix())
+		if err := m.run(ctx, migration.Up, record); err != nil {
+			return fmt.Errorf("migration %v_%v failed: %v", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// Down は適用済みのマイグレーションを新しい順に指定数だけ取り消します
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		log.Printf("migrate down: %v_%v", migration.Version, migration.Name)
+		record := m.builder.Delete(SCHEMA_VERSIONS).
+			Where(squirrel.Eq{
+				"version": migration.Version,
+			})
+		if err := m.run(ctx, migration.Down, record); err != nil {
+			return fmt.Errorf("migration %v_%v failed: %v", migration.Version, migration.Name, err)
+		}
+		steps--
+	}
+	return nil
+}
+
+// run はSQLファイルと適用状況の記録を実行します
+// PostgreSQLとSQLiteでは1つのトランザクションで実行し、途中で失敗しても適用前の状態に戻す
+// MySQLのDDLは暗黙的にコミットされるためトランザクションは使わない
+func (m *Migrator) run(ctx context.Context, body string, record squirrel.Sqlizer) error {
+	if m.db.Driver == db.DriverMySQL {
+		if err := exec(ctx, m.db.DB, body); err != nil {
+			return err
+		}
+		_, err := squirrel.ExecContextWith(ctx, m.db.DB, record)
+		return err
+	}
+	tx, err := m.db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := exec(ctx, tx, body); err != nil {
+		return err
+	}
+	if _, err := squirrel.ExecContextWith(ctx, tx, record); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// exec はSQLファイルを文ごとに分割して実行します
+func exec(ctx context.Context, runner squirrel.ExecerContext, body string) error {
+	for _, stmt := range splitStatements(body) {
+		if _, err := runner.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements は行末の ; で文を区切ります。コメント行は除外します
+func splitStatements(body string) []string {
+	var ret []string
+	var current []string
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			stmt := strings.TrimSuffix(strings.TrimSpace(strings.Join(current, "\n")), ";")
+			ret = append(ret, stmt)
+			current = nil
+		}
+	}
+	if stmt := strings.TrimSpace(strings.Join(current, "\n")); stmt != "" {
+		ret = append(ret, stmt)
+	}
+	return ret
+}
+
+// Schema はデータベースのテーブル定義を比較可能な行の集合として返します
+func Schema(ctx context.Context, client *db.Client, dbName string) ([]string, error) {
+	var ret []string
+	var err error
+	switch client.Driver {
+	case db.DriverPostgres:
+		ret, err = postgresSchema(ctx, client, dbName)
+	case db.DriverSQLite:
+		ret, err = sqliteSchema(ctx, client)
+	default:
+		ret, err = mysqlSchema(ctx, client, dbName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func mysqlSchema(ctx context.Context, client *db.Client, dbName string) ([]string, error) {
+	var ret []string
+	rows, err := squirrel.Select("TABLE_NAME", "COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COALESCE(COLUMN_DEFAULT, 'NULL')", "EXTRA").
+		From("information_schema.COLUMNS").
+		Where(squirrel.Eq{
+			"TABLE_SCHEMA": dbName,
+		}).
+		RunWith(client.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, column, columnType, nullable, def, extra string
+		if err := rows.Scan(&table, &column, &columnType, &nullable, &def, &extra); err != nil {
+			return nil, err
+		}
+		ret = append(ret, fmt.Sprintf("column %v.%v %v nullable=%v default=%v %v", table, column, columnType, nullable, def, extra))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	indexRows, err := squirrel.Select("TABLE_NAME", "INDEX_NAME", "NON_UNIQUE", "GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX)").
+		From("information_schema.STATISTICS").
+		Where(squirrel.Eq{
+			"TABLE_SCHEMA": dbName,
+		}).
+		GroupBy("TABLE_NAME", "INDEX_NAME", "NON_UNIQUE").
+		RunWith(client.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer indexRows.Close()
+	for indexRows.Next() {
+		var table, index, columns string
+		var nonUnique int
+		if err := indexRows.Scan(&table, &index, &nonUnique, &columns); err != nil {
+			return nil, err
+		}
+		ret = append(ret, fmt.Sprintf("index %v.%v unique=%v (%v)", table, index, nonUnique == 0, columns))
+	}
+	if err := indexRows.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func postgresSchema(ctx context.Context, client *db.Client, dbName string) ([]string, error) {
+	builder := statementBuilder(client)
+	var ret []string
+	rows, err := builder.Select("table_name", "column_name", "data_type", "COALESCE(character_maximum_length, 0)", "is_nullable", "COALESCE(column_default, 'NULL')").
+		From("information_schema.columns").
+		Where(squirrel.Eq{
+			"table_catalog": dbName,
+			"table_schema":  "public",
+		}).
+		RunWith(client.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, column, dataType, nullable, def string
+		var length int
+		if err := rows.Scan(&table, &column, &dataType, &length, &nullable, &def); err != nil {
+			return nil, err
+		}
+		if length > 0 {
+			dataType = fmt.Sprintf("%v(%v)", dataType, length)
+		}
+		ret = append(ret, fmt.Sprintf("column %v.%v %v nullable=%v default=%v", table, column, dataType, nullable, def))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	indexRows, err := builder.Select("tablename", "indexname", "indexdef").
+		From("pg_indexes").
+		Where(squirrel.Eq{
+			"schemaname": "public",
+		}).
+		RunWith(client.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer indexRows.Close()
+	for indexRows.Next() {
+		var table, index, def string
+		if err := indexRows.Scan(&table, &index, &def); err != nil {
+			return nil, err
+		}
+		ret = append(ret, fmt.Sprintf("index %v.%v %v", table, index, def))
+	}
+	if err := indexRows.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// sqliteSchema はテーブルとインデックスの定義文を返します
+// ALTER TABLE で追加した列も定義文に反映されるため、定義文同士を比較すればよい
+func sqliteSchema(ctx context.Context, client *db.Client) ([]string, error) {
+	rows, err := squirrel.Select("type", "tbl_name", "name", "sql").
+		From("sqlite_master").
+		Where("name NOT LIKE 'sqlite_%' AND sql IS NOT NULL").
+		RunWith(client.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []string
+	for rows.Next() {
+		var kind, table, name, def string
+		if err := rows.Scan(&kind, &table, &name, &def); err != nil {
+			return nil, err
+		}
+		ret = append(ret, fmt.Sprintf("%v %v.%v %v", kind, table, name, strings.Join(strings.Fields(def), " ")))
+	}
+	return ret, rows.Err()
+}
+
+// Diff は期待するスキーマと実際のスキーマの差分を返します
+// 期待側にのみある行は "-"、実際側にのみある行は "+" を付けて返します
+func Diff(expected, actual []string) []string {
+	exists := func(list []string) map[string]bool {
+		ret := map[string]bool{}
+		for _, v := range list {
+			ret[v] = true
+		}
+		return ret
+	}
+	inExpected, inActual := exists(expected), exists(actual)
+	var ret []string
+	for _, v := range expected {
+		if !inActual[v] {
+			ret = append(ret, "- "+v)
+		}
+	}
+	for _, v := range actual {
+		if !inExpected[v] {
+			ret = append(ret, "+ "+v)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,250 @@
+package migration
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mochisuna/linebot-sample/config"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+)
+
+func newSQLite(t *testing.T) *db.Client {
+	t.Helper()
+	client, err := db.New(&config.DB{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "empty",
+			body: "\n-- comment only\n\n",
+			want: nil,
+		},
+		{
+			name: "single line",
+			body: "DROP TABLE a;",
+			want: []string{"DROP TABLE a"},
+		},
+		{
+			name: "multi line with comments",
+			body: "-- create\nCREATE TABLE a (\n  id int\n);\n\n-- index\nCREATE INDEX i ON a (id);\n",
+			want: []string{"CREATE TABLE a (\n  id int\n)", "CREATE INDEX i ON a (id)"},
+		},
+		{
+			name: "missing trailing semicolon",
+			body: "UPDATE a SET id = 1;\nDELETE FROM a",
+			want: []string{"UPDATE a SET id = 1", "DELETE FROM a"},
+		},
+		{
+			name: "semicolon inside a line is not a separator",
+			body: "INSERT INTO a VALUES (';');",
+			want: []string{"INSERT INTO a VALUES (';')"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+		actual   []string
+		want     []string
+	}{
+		{"same", []string{"a", "b"}, []string{"a", "b"}, nil},
+		{"missing", []string{"a", "b"}, []string{"a"}, []string{"- b"}},
+		{"extra", []string{"a"}, []string{"a", "c"}, []string{"+ c"}},
+		{"changed", []string{"a int"}, []string{"a bigint"}, []string{"- a int", "+ a bigint"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.expected, tt.actual); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpDownRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	client := newSQLite(t)
+	m, err := New(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	before, err := Schema(ctx, client, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(ctx, len(m.migrations)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	after, err := Schema(ctx, client, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := Diff(before, after); len(diff) > 0 {
+		t.Errorf("schema changed after down and up:\n%v", diff)
+	}
+}
+
+// TestUpRollsBackFailedMigration はSQLiteで途中の文が失敗した場合に、そのファイルの変更と記録が残らないことを確認します
+func TestUpRollsBackFailedMigration(t *testing.T) {
+	ctx := context.Background()
+	client := newSQLite(t)
+	m := &Migrator{
+		db:      client,
+		builder: statementBuilder(client),
+		migrations: []Migration{
+			{Version: 1, Name: "broken", Up: "CREATE TABLE a (id int);\nINSERT INTO missing VALUES (1);", Down: "DROP TABLE a;"},
+		},
+	}
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("Up() succeeded, want error")
+	}
+	var count int
+	if err := client.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'a'").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Error("table a was left behind by the failed migration")
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].Applied {
+		t.Error("failed migration was recorded as applied")
+	}
+}
+
+func TestAdoptLegacySchemaMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		dirty   bool
+		wantErr bool
+	}{
+		{name: "clean", version: 5},
+		{name: "dirty", version: 5, dirty: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := newSQLite(t)
+			m, err := New(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 以前の migrate コマンドで適用済みのデータベースを再現する
+			for _, migration := range m.migrations[:tt.version] {
+				if err := exec(ctx, client.DB, migration.Up); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := client.DB.ExecContext(ctx, "CREATE TABLE "+LEGACY_SCHEMA_MIGRATIONS+" (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.DB.ExecContext(ctx, "INSERT INTO "+LEGACY_SCHEMA_MIGRATIONS+" VALUES (?, ?)", tt.version, tt.dirty); err != nil {
+				t.Fatal(err)
+			}
+
+			err = m.Up(ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Up() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			statuses, err := m.Status(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, st := range statuses {
+				if !st.Applied || st.Modified {
+					t.Errorf("migration %v: applied=%v modified=%v", st.Version, st.Applied, st.Modified)
+				}
+			}
+		})
+	}
+}
+
+// TestUniqueActiveParticipationTieBreak は同じ時刻に複数のイベントへ参加中のユーザーがいても、1件だけ残して一意制約を作れることを確認します
+func TestUniqueActiveParticipationTieBreak(t *testing.T) {
+	ctx := context.Background()
+	client := newSQLite(t)
+	m, err := New(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := m.migrations
+	m.migrations = all[:5]
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rows := []struct {
+		user, event string
+		updatedAt   int
+	}{
+		{"U1", "e1", 100},
+		{"U1", "e2", 100},
+		{"U1", "e3", 50},
+		{"U2", "e1", 100},
+	}
+	for _, r := range rows {
+		if _, err := client.DB.ExecContext(ctx, "INSERT INTO event_participants (user_id, event_id, is_participated, created_at, updated_at) VALUES (?, ?, 1, ?, ?)", r.user, r.event, r.updatedAt, r.updatedAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m.migrations = all
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	result, err := client.DB.QueryContext(ctx, "SELECT user_id, event_id FROM event_participants WHERE is_participated = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer result.Close()
+	for result.Next() {
+		var user, event string
+		if err := result.Scan(&user, &event); err != nil {
+			t.Fatal(err)
+		}
+		if prev, ok := got[user]; ok {
+			t.Fatalf("%v is still participating in %v and %v", user, prev, event)
+		}
+		got[user] = event
+	}
+	want := map[string]string{"U1": "e2", "U2": "e1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("active participations = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,2 @@
+ALTER TABLE `event_statuses`
+  DROP COLUMN `opened_at`;
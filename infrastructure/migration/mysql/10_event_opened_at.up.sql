@@ -0,0 +1,4 @@
+-- 開催前の登録時刻 (created_at) と区別するため、開催した時刻を記録する
+-- 既存のイベントは開催時刻が分からないので 0 のままにする
+ALTER TABLE `event_statuses`
+  ADD COLUMN `opened_at` bigint(20) unsigned NOT NULL DEFAULT 0 AFTER `vote_policy`;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `event_votes`;
+DROP TABLE IF EXISTS `event_participants`;
+DROP TABLE IF EXISTS `event_statuses`;
+DROP TABLE IF EXISTS `events`;
+DROP TABLE IF EXISTS `owners`;
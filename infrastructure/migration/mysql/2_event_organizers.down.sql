@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `event_invitations`;
+DROP TABLE IF EXISTS `event_organizers`;
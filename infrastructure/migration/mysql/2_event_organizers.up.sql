@@ -0,0 +1,25 @@
+CREATE TABLE `event_organizers`
+(
+  `event_id`   varchar(30) NOT NULL,
+  `owner_id`   varchar(33) NOT NULL,
+  `role`       int(1) NOT NULL,
+  `created_at` bigint(20) unsigned NOT NULL,
+  `updated_at` bigint(20) unsigned NOT NULL,
+  PRIMARY KEY (`event_id`, `owner_id`),
+  KEY `idx_owner_id` (`owner_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 既存イベントの主催者を主催者テーブルへ移行
+INSERT INTO `event_organizers` (`event_id`, `owner_id`, `role`, `created_at`, `updated_at`)
+SELECT `event_id`, `owner_id`, 0, `created_at`, `updated_at` FROM `event_statuses`;
+
+CREATE TABLE `event_invitations`
+(
+  `invite_code` varchar(16) NOT NULL,
+  `event_id`    varchar(30) NOT NULL,
+  `owner_id`    varchar(33) NOT NULL,
+  `created_at`  bigint(20) unsigned NOT NULL,
+  `updated_at`  bigint(20) unsigned NOT NULL,
+  PRIMARY KEY (`invite_code`),
+  KEY `idx_event_id` (`event_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,4 @@
+ALTER TABLE `event_statuses`
+  DROP KEY `uniq_active_join_code`,
+  DROP COLUMN `active_join_code`,
+  DROP COLUMN `join_code`;
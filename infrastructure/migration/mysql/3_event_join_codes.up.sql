@@ -0,0 +1,5 @@
+-- 参加コードは終了していないイベント間でのみ一意とし、終了後は再利用できるようにする
+ALTER TABLE `event_statuses`
+  ADD COLUMN `join_code` varchar(8) DEFAULT NULL AFTER `status`,
+  ADD COLUMN `active_join_code` varchar(8) GENERATED ALWAYS AS (IF(`status` <> 2, `join_code`, NULL)) VIRTUAL,
+  ADD UNIQUE KEY `uniq_active_join_code` (`active_join_code`);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `event_passcode_failures`;
+
+ALTER TABLE `event_statuses`
+  DROP COLUMN `passcode`,
+  DROP COLUMN `is_private`;
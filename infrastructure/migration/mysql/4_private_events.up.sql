@@ -0,0 +1,13 @@
+ALTER TABLE `event_statuses`
+  ADD COLUMN `is_private` tinyint(1) NOT NULL DEFAULT 0 AFTER `join_code`,
+  ADD COLUMN `passcode` varchar(8) DEFAULT NULL AFTER `is_private`;
+
+CREATE TABLE `event_passcode_failures`
+(
+  `id`         int(20) NOT NULL AUTO_INCREMENT,
+  `event_id`   varchar(30) NOT NULL,
+  `user_id`    varchar(33) NOT NULL,
+  `created_at` bigint(20) unsigned NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_event_id_user_id` (`event_id`, `user_id`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
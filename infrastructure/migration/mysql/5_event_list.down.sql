@@ -0,0 +1,9 @@
+ALTER TABLE `event_participants`
+  DROP KEY `idx_event_id_is_participated`;
+
+ALTER TABLE `event_statuses`
+  DROP KEY `idx_status_created_at`,
+  DROP COLUMN `title`;
+
+ALTER TABLE `owners`
+  DROP COLUMN `display_name`;
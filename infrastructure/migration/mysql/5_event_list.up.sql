@@ -0,0 +1,9 @@
+ALTER TABLE `owners`
+  ADD COLUMN `display_name` varchar(64) NOT NULL DEFAULT '' AFTER `owner_id`;
+
+ALTER TABLE `event_statuses`
+  ADD COLUMN `title` varchar(64) NOT NULL DEFAULT '' AFTER `status`,
+  ADD KEY `idx_status_created_at` (`status`, `created_at`);
+
+ALTER TABLE `event_participants`
+  ADD KEY `idx_event_id_is_participated` (`event_id`, `is_participated`);
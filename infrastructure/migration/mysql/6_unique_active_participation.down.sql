@@ -0,0 +1,3 @@
+ALTER TABLE `event_participants`
+  DROP KEY `uniq_active_user_id`,
+  DROP COLUMN `active_user_id`;
@@ -0,0 +1,19 @@
+-- 終了済みイベントに残っている参加者を離脱させる
+UPDATE `event_participants` AS ep
+  JOIN `event_statuses` AS es ON es.`event_id` = ep.`event_id`
+  SET ep.`is_participated` = 0
+  WHERE es.`status` = 2 AND ep.`is_participated` = 1;
+
+-- 複数のイベントに参加中のユーザーは最後に参加したイベントのみ残す
+-- updated_at は秒単位で同じ値になりうるため、同じ時刻の場合は event_id が大きい方を残す
+UPDATE `event_participants` AS ep
+  JOIN `event_participants` AS newer
+    ON newer.`user_id` = ep.`user_id` AND newer.`is_participated` = 1
+    AND (newer.`updated_at` > ep.`updated_at` OR (newer.`updated_at` = ep.`updated_at` AND newer.`event_id` > ep.`event_id`))
+  SET ep.`is_participated` = 0
+  WHERE ep.`is_participated` = 1;
+
+-- 参加中のイベントはユーザーごとに1つまで
+ALTER TABLE `event_participants`
+  ADD COLUMN `active_user_id` varchar(33) GENERATED ALWAYS AS (IF(`is_participated` = 1, `user_id`, NULL)) VIRTUAL,
+  ADD UNIQUE KEY `uniq_active_user_id` (`active_user_id`);
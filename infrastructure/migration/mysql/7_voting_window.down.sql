@@ -0,0 +1,3 @@
+ALTER TABLE `event_statuses`
+  DROP COLUMN `vote_closes_at`,
+  DROP COLUMN `is_voting`;
@@ -0,0 +1,8 @@
+ALTER TABLE `event_statuses`
+  ADD COLUMN `is_voting` tinyint(1) NOT NULL DEFAULT 0 AFTER `passcode`,
+  ADD COLUMN `vote_closes_at` bigint(20) unsigned NOT NULL DEFAULT 0 AFTER `is_voting`;
+
+-- 開催中のイベントはこれまで通り投票を受け付ける
+UPDATE `event_statuses`
+  SET `is_voting` = 1
+  WHERE `status` = 1;
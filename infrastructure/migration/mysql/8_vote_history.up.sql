@@ -0,0 +1,25 @@
+ALTER TABLE `event_statuses`
+  ADD COLUMN `vote_opened_at` bigint(20) unsigned NOT NULL DEFAULT 0 AFTER `vote_closes_at`,
+  ADD COLUMN `vote_policy` int(1) NOT NULL DEFAULT 0 AFTER `vote_opened_at`;
+
+UPDATE `event_statuses`
+  SET `vote_opened_at` = `updated_at`
+  WHERE `is_voting` = 1;
+
+CREATE TABLE `event_vote_histories`
+(
+  `id`            int(20) NOT NULL AUTO_INCREMENT,
+  `event_id`      varchar(30) NOT NULL,
+  `user_id`       varchar(33) NOT NULL,
+  `vote`          int(1) NOT NULL,
+  `previous_vote` int(1) NOT NULL,
+  `created_at`    bigint(20) unsigned NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_event_id_created_at` (`event_id`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 既存の投票は最後の投票のみ履歴に残す
+INSERT INTO `event_vote_histories` (`event_id`, `user_id`, `vote`, `previous_vote`, `created_at`)
+  SELECT `event_id`, `user_id`, `vote`, 0, `updated_at`
+  FROM `event_votes`
+  WHERE `vote` <> 0;
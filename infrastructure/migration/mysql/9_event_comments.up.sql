@@ -0,0 +1,10 @@
+CREATE TABLE `event_comments`
+(
+  `id`         int(20) NOT NULL AUTO_INCREMENT,
+  `event_id`   varchar(30) NOT NULL,
+  `user_id`    varchar(33) NOT NULL,
+  `comment`    varchar(200) NOT NULL,
+  `created_at` bigint(20) unsigned NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_event_id_created_at` (`event_id`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
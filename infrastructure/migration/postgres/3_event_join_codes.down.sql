@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS uniq_active_join_code;
+ALTER TABLE event_statuses
+  DROP COLUMN join_code;
@@ -0,0 +1,4 @@
+-- 参加コードは終了していないイベント間でのみ一意とし、終了後は再利用できるようにする
+ALTER TABLE event_statuses
+  ADD COLUMN join_code varchar(8) DEFAULT NULL;
+CREATE UNIQUE INDEX uniq_active_join_code ON event_statuses (join_code) WHERE status <> 2;
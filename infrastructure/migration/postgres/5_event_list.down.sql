@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_event_participants_event_id_is_participated;
+
+DROP INDEX IF EXISTS idx_event_statuses_status_created_at;
+ALTER TABLE event_statuses
+  DROP COLUMN title;
+
+ALTER TABLE owners
+  DROP COLUMN display_name;
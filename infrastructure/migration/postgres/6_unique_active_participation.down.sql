@@ -0,0 +1 @@
+DROP INDEX IF EXISTS uniq_active_user_id;
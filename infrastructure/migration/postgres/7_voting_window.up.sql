@@ -0,0 +1,8 @@
+ALTER TABLE event_statuses
+  ADD COLUMN is_voting boolean NOT NULL DEFAULT false,
+  ADD COLUMN vote_closes_at bigint NOT NULL DEFAULT 0;
+
+-- 開催中のイベントはこれまで通り投票を受け付ける
+UPDATE event_statuses
+  SET is_voting = true
+  WHERE status = 1;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS event_vote_histories;
+
+ALTER TABLE event_statuses
+  DROP COLUMN vote_policy,
+  DROP COLUMN vote_opened_at;
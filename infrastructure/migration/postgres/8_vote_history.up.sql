@@ -0,0 +1,25 @@
+ALTER TABLE event_statuses
+  ADD COLUMN vote_opened_at bigint NOT NULL DEFAULT 0,
+  ADD COLUMN vote_policy smallint NOT NULL DEFAULT 0;
+
+UPDATE event_statuses
+  SET vote_opened_at = updated_at
+  WHERE is_voting = true;
+
+CREATE TABLE event_vote_histories
+(
+  id            serial NOT NULL,
+  event_id      varchar(30) NOT NULL,
+  user_id       varchar(33) NOT NULL,
+  vote          smallint NOT NULL,
+  previous_vote smallint NOT NULL,
+  created_at    bigint NOT NULL,
+  PRIMARY KEY (id)
+);
+CREATE INDEX idx_event_vote_histories_event_id_created_at ON event_vote_histories (event_id, created_at);
+
+-- 既存の投票は最後の投票のみ履歴に残す
+INSERT INTO event_vote_histories (event_id, user_id, vote, previous_vote, created_at)
+  SELECT event_id, user_id, vote, 0, updated_at
+  FROM event_votes
+  WHERE vote <> 0;
@@ -0,0 +1,10 @@
+CREATE TABLE event_comments
+(
+  id         serial NOT NULL,
+  event_id   varchar(30) NOT NULL,
+  user_id    varchar(33) NOT NULL,
+  comment    varchar(200) NOT NULL,
+  created_at bigint NOT NULL,
+  PRIMARY KEY (id)
+);
+CREATE INDEX idx_event_comments_event_id_created_at ON event_comments (event_id, created_at);
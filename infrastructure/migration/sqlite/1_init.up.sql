@@ -0,0 +1,52 @@
+CREATE TABLE owners
+(
+  owner_id   varchar(33) NOT NULL,
+  created_at bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  PRIMARY KEY (owner_id)
+);
+
+CREATE TABLE events
+(
+  id         integer NOT NULL,
+  event_id   varchar(30) NOT NULL,
+  created_at bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  PRIMARY KEY (id)
+);
+CREATE INDEX idx_events_event_id ON events (event_id);
+
+CREATE TABLE event_statuses
+(
+  owner_id   varchar(33) NOT NULL,
+  event_id   varchar(30) NOT NULL,
+  status     integer NOT NULL,
+  created_at bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  PRIMARY KEY (owner_id, event_id)
+);
+CREATE INDEX idx_event_statuses_owner_id ON event_statuses (owner_id);
+CREATE INDEX idx_event_statuses_event_id ON event_statuses (event_id);
+CREATE INDEX idx_event_statuses_status ON event_statuses (status);
+
+CREATE TABLE event_participants
+(
+  user_id         varchar(33) NOT NULL,
+  event_id        varchar(30) NOT NULL,
+  is_participated integer NOT NULL,
+  created_at      bigint NOT NULL,
+  updated_at      bigint NOT NULL,
+  PRIMARY KEY (user_id, event_id)
+);
+CREATE INDEX idx_event_participants_is_participated ON event_participants (is_participated);
+
+CREATE TABLE event_votes
+(
+  event_id   varchar(30) NOT NULL,
+  user_id    varchar(33) NOT NULL,
+  vote       integer NOT NULL,
+  created_at bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  PRIMARY KEY (event_id, user_id)
+);
+CREATE INDEX idx_event_votes_user_id ON event_votes (user_id);
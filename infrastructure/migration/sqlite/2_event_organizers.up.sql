@@ -0,0 +1,25 @@
+CREATE TABLE event_organizers
+(
+  event_id   varchar(30) NOT NULL,
+  owner_id   varchar(33) NOT NULL,
+  role       integer NOT NULL,
+  created_at bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  PRIMARY KEY (event_id, owner_id)
+);
+CREATE INDEX idx_event_organizers_owner_id ON event_organizers (owner_id);
+
+-- 既存イベントの主催者を主催者テーブルへ移行
+INSERT INTO event_organizers (event_id, owner_id, role, created_at, updated_at)
+SELECT event_id, owner_id, 0, created_at, updated_at FROM event_statuses;
+
+CREATE TABLE event_invitations
+(
+  invite_code varchar(16) NOT NULL,
+  event_id    varchar(30) NOT NULL,
+  owner_id    varchar(33) NOT NULL,
+  created_at  bigint NOT NULL,
+  updated_at  bigint NOT NULL,
+  PRIMARY KEY (invite_code)
+);
+CREATE INDEX idx_event_invitations_event_id ON event_invitations (event_id);
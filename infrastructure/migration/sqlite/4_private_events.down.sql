@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS event_passcode_failures;
+
+ALTER TABLE event_statuses
+  DROP COLUMN passcode;
+ALTER TABLE event_statuses
+  DROP COLUMN is_private;
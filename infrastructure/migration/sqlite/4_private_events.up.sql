@@ -0,0 +1,14 @@
+ALTER TABLE event_statuses
+  ADD COLUMN is_private integer NOT NULL DEFAULT 0;
+ALTER TABLE event_statuses
+  ADD COLUMN passcode varchar(8) DEFAULT NULL;
+
+CREATE TABLE event_passcode_failures
+(
+  id         integer NOT NULL,
+  event_id   varchar(30) NOT NULL,
+  user_id    varchar(33) NOT NULL,
+  created_at bigint NOT NULL,
+  PRIMARY KEY (id)
+);
+CREATE INDEX idx_event_passcode_failures_event_id_user_id ON event_passcode_failures (event_id, user_id, created_at);
@@ -0,0 +1,8 @@
+ALTER TABLE owners
+  ADD COLUMN display_name varchar(64) NOT NULL DEFAULT '';
+
+ALTER TABLE event_statuses
+  ADD COLUMN title varchar(64) NOT NULL DEFAULT '';
+CREATE INDEX idx_event_statuses_status_created_at ON event_statuses (status, created_at);
+
+CREATE INDEX idx_event_participants_event_id_is_participated ON event_participants (event_id, is_participated);
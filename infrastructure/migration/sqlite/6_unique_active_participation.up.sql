@@ -0,0 +1,18 @@
+-- 終了済みイベントに残っている参加者を離脱させる
+UPDATE event_participants AS ep
+  SET is_participated = 0
+  FROM event_statuses AS es
+  WHERE es.event_id = ep.event_id AND es.status = 2 AND ep.is_participated = 1;
+
+-- 複数のイベントに参加中のユーザーは最後に参加したイベントのみ残す
+-- updated_at は秒単位で同じ値になりうるため、同じ時刻の場合は event_id が大きい方を残す
+UPDATE event_participants AS ep
+  SET is_participated = 0
+  WHERE ep.is_participated = 1 AND EXISTS (
+    SELECT 1 FROM event_participants AS newer
+    WHERE newer.user_id = ep.user_id AND newer.is_participated = 1
+      AND (newer.updated_at > ep.updated_at OR (newer.updated_at = ep.updated_at AND newer.event_id > ep.event_id))
+  );
+
+-- 参加中のイベントはユーザーごとに1つまで
+CREATE UNIQUE INDEX uniq_active_user_id ON event_participants (user_id) WHERE is_participated = 1;
@@ -0,0 +1,4 @@
+ALTER TABLE event_statuses
+  DROP COLUMN vote_closes_at;
+ALTER TABLE event_statuses
+  DROP COLUMN is_voting;
@@ -0,0 +1,9 @@
+ALTER TABLE event_statuses
+  ADD COLUMN is_voting integer NOT NULL DEFAULT 0;
+ALTER TABLE event_statuses
+  ADD COLUMN vote_closes_at bigint NOT NULL DEFAULT 0;
+
+-- 開催中のイベントはこれまで通り投票を受け付ける
+UPDATE event_statuses
+  SET is_voting = 1
+  WHERE status = 1;
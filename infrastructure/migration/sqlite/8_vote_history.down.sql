@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS event_vote_histories;
+
+ALTER TABLE event_statuses
+  DROP COLUMN vote_policy;
+ALTER TABLE event_statuses
+  DROP COLUMN vote_opened_at;
@@ -0,0 +1,175 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/logger"
+)
+
+type organizerRepository struct {
+	dbm *db.Client
+	dbs *db.Client
+}
+
+func NewOrganizerRepository(dbmClient *db.Client, dbsClient *db.Client) repository.OrganizerRepository {
+	return &organizerRepository{
+		dbm: dbmClient,
+		dbs: dbsClient,
+	}
+}
+
+func (r *organizerRepository) Select(ctx context.Context, eventID domain.EventID, ownerID domain.OwnerID) (*domain.Organizer, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.organizer Select")
+	var col eventOrganizersColumns
+	err := squirrel.Select("event_id", "owner_id", "role", "created_at", "updated_at").
+		From(EVENT_ORGANIZERS).
+		Where(squirrel.Eq{
+			"event_id": eventID,
+			"owner_id": ownerID,
+		}).
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
+		Scan(
+			&col.EventID,
+			&col.OwnerID,
+			&col.Role,
+			&col.CreatedAt,
+			&col.UpdatedAt,
+		)
+	return &domain.Organizer{
+		EventID:   col.EventID,
+		OwnerID:   col.OwnerID,
+		Role:      col.Role,
+		CreatedAt: col.CreatedAt,
+		UpdatedAt: col.UpdatedAt,
+	}, err
+}
+
+func (r *organizerRepository) SelectList(ctx context.Context, eventID domain.EventID) ([]domain.Organizer, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.organizer SelectList")
+	var ret []domain.Organizer
+	rows, err := squirrel.Select("eo.event_id", "eo.owner_id", "eo.role", "COALESCE(o.display_name, '')", "eo.created_at", "eo.updated_at").
+		From(EVENT_ORGANIZERS + " AS eo").
+		LeftJoin(OWNERS + " AS o ON o.owner_id = eo.owner_id").
+		Where(squirrel.Eq{
+			"eo.event_id": eventID,
+		}).
+		OrderBy("eo.created_at").
+		RunWith(runner(ctx, r.dbs)).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var col eventOrganizersColumns
+		var displayName string
+		err = rows.Scan(
+			&col.EventID,
+			&col.OwnerID,
+			&col.Role,
+			&displayName,
+			&col.CreatedAt,
+			&col.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, domain.Organizer{
+			EventID:     col.EventID,
+			OwnerID:     col.OwnerID,
+			Role:        col.Role,
+			DisplayName: displayName,
+			CreatedAt:   col.CreatedAt,
+			UpdatedAt:   col.UpdatedAt,
+		})
+	}
+	return ret, rows.Err()
+}
+
+func (r *organizerRepository) SelectInvitation(ctx context.Context, code string) (*domain.Invitation, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.organizer SelectInvitation")
+	return r.selectInvitation(ctx, squirrel.Eq{
+		"invite_code": code,
+	})
+}
+
+func (r *organizerRepository) SelectInvitationByEventID(ctx context.Context, eventID domain.EventID) (*domain.Invitation, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.organizer SelectInvitationByEventID")
+	return r.selectInvitation(ctx, squirrel.Eq{
+		"event_id": eventID,
+	})
+}
+
+func (r *organizerRepository) selectInvitation(ctx context.Context, param squirrel.Eq) (*domain.Invitation, error) {
+	var col eventInvitationsColumns
+	err := squirrel.Select("invite_code", "event_id", "owner_id", "created_at", "updated_at").
+		From(EVENT_INVITATIONS).
+		Where(param).
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
+		Scan(
+			&col.InviteCode,
+			&col.EventID,
+			&col.OwnerID,
+			&col.CreatedAt,
+			&col.UpdatedAt,
+		)
+	return &domain.Invitation{
+		Code:      col.InviteCode,
+		EventID:   col.EventID,
+		OwnerID:   col.OwnerID,
+		CreatedAt: col.CreatedAt,
+		UpdatedAt: col.UpdatedAt,
+	}, err
+}
+
+func (r *organizerRepository) Create(ctx context.Context, organizer *domain.Organizer) error {
+	logger.FromContext(ctx).Debug("called infrastructure.organizer Create")
+	_, err := squirrel.Insert(EVENT_ORGANIZERS).
+		Columns("event_id", "owner_id", "role", "created_at", "updated_at").
+		Values(organizer.EventID, organizer.OwnerID, organizer.Role, organizer.CreatedAt, organizer.UpdatedAt).
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
+	return err
+}
+
+// Delete は共同主催者のみ削除可能
+func (r *organizerRepository) Delete(ctx context.Context, organizer *domain.Organizer) error {
+	logger.FromContext(ctx).Debug("called infrastructure.organizer Delete")
+	_, err := squirrel.Delete(EVENT_ORGANIZERS).
+		Where(squirrel.Eq{
+			"event_id": organizer.EventID,
+			"owner_id": organizer.OwnerID,
+			"role":     domain.ORGANIZER_CO,
+		}).
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
+	return err
+}
+
+func (r *organizerRepository) CreateInvitation(ctx context.Context, invitation *domain.Invitation) error {
+	logger.FromContext(ctx).Debug("called infrastructure.organizer CreateInvitation")
+	_, err := squirrel.Insert(EVENT_INVITATIONS).
+		Columns("invite_code", "event_id", "owner_id", "created_at", "updated_at").
+		Values(invitation.Code, invitation.EventID, invitation.OwnerID, invitation.CreatedAt, invitation.UpdatedAt).
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
+	return err
+}
+
+// DeleteInvitation はイベントの招待コードを無効にします
+func (r *organizerRepository) DeleteInvitation(ctx context.Context, eventID domain.EventID) error {
+	logger.FromContext(ctx).Debug("called infrastructure.organizer DeleteInvitation")
+	_, err := squirrel.Delete(EVENT_INVITATIONS).
+		Where(squirrel.Eq{
+			"event_id": eventID,
+		}).
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
+	return err
+}
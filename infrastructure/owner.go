@@ -2,13 +2,12 @@ package infrastructure
 
 import (
 	"context"
-	"database/sql"
-	"log"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/mochisuna/linebot-sample/domain"
 	"github.com/mochisuna/linebot-sample/domain/repository"
 	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/logger"
 )
 
 type ownerRepository struct {
@@ -23,56 +22,53 @@ func NewOwnerRepository(dbmClient *db.Client, dbsClient *db.Client) repository.O
 	}
 }
 
-// TODO 共通化
-func (r *ownerRepository) WithTransaction(ctx context.Context, txFunc func(*sql.Tx) error) error {
-	tx, err := r.dbm.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if p := recover(); p != nil {
-			tx.Rollback()
-			panic(p) // re-throw panic after Rollback
-		} else if err != nil {
-			tx.Rollback()
-		} else {
-			err = tx.Commit()
-		}
-	}()
-	err = txFunc(tx)
-	return err
-}
-
 // upsert 処理
-func (r *ownerRepository) Create(owner *domain.Owner, tx *sql.Tx) error {
-	log.Println("called infrastructure.owner Create")
+func (r *ownerRepository) Create(ctx context.Context, owner *domain.Owner) error {
+	logger.FromContext(ctx).Debug("called infrastructure.owner Create")
 	_, err := squirrel.Insert(OWNERS).
-		Columns("owner_id", "created_at", "updated_at").
-		Values(owner.ID, owner.CreatedAt, owner.UpdatedAt).
-		RunWith(tx).
-		Exec()
+		Columns("owner_id", "display_name", "created_at", "updated_at").
+		Values(owner.ID, owner.DisplayName, owner.CreatedAt, owner.UpdatedAt).
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
 	return err
 
 }
 
-func (r *ownerRepository) Select(ownerID domain.OwnerID) (*domain.Owner, error) {
-	log.Println("called infrastructure.owner Select")
+func (r *ownerRepository) Update(ctx context.Context, owner *domain.Owner) error {
+	logger.FromContext(ctx).Debug("called infrastructure.owner Update")
+	_, err := squirrel.Update(OWNERS).
+		SetMap(squirrel.Eq{
+			"display_name": owner.DisplayName,
+			"updated_at":   owner.UpdatedAt,
+		}).
+		Where(squirrel.Eq{
+			"owner_id": owner.ID,
+		}).
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
+	return err
+}
+
+func (r *ownerRepository) Select(ctx context.Context, ownerID domain.OwnerID) (*domain.Owner, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.owner Select")
 	var col ownerColumns
-	err := squirrel.Select("owner_id", "created_at", "updated_at").
+	err := squirrel.Select("owner_id", "display_name", "created_at", "updated_at").
 		From(OWNERS).
 		Where(squirrel.Eq{
 			"owner_id": ownerID,
 		}).
-		RunWith(r.dbs.DB).
-		QueryRow().
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
 		Scan(
 			&col.OwnerID,
+			&col.DisplayName,
 			&col.CreatedAt,
 			&col.UpdatedAt,
 		)
 	return &domain.Owner{
-		ID:        col.OwnerID,
-		CreatedAt: col.CreatedAt,
-		UpdatedAt: col.UpdatedAt,
+		ID:          col.OwnerID,
+		DisplayName: col.DisplayName,
+		CreatedAt:   col.CreatedAt,
+		UpdatedAt:   col.UpdatedAt,
 	}, err
 }
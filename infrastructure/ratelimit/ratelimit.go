@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/config"
+)
+
+// 設定がない場合の既定値
+const (
+	defaultRate  = 1.0
+	defaultBurst = 5
+)
+
+// 使われていないバケットを掃除する間隔
+const sweepInterval = time.Minute
+
+const (
+	BackendNone   = "none"
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Rule はトークンバケットの設定
+type Rule struct {
+	Rate  float64 // 1秒あたりに回復する回数
+	Burst int     // 続けて実行できる回数
+}
+
+// store はバケットの保存先。共有ストレージは now を使わず自身の時刻で回復量を計算する
+type store interface {
+	take(ctx context.Context, key string, rule Rule, now time.Time) (bool, error)
+}
+
+// Limiter はユーザーとコマンドごとにトークンバケットで実行回数を制限します
+type Limiter struct {
+	store    store
+	rule     Rule
+	commands map[string]Rule
+}
+
+// New は設定に従ってリミッターを生成します。無効な場合は nil を返します
+// redis の場合は [cache] の接続先を使います
+func New(conf *config.RateLimit, cacheConf *config.Cache) (*Limiter, error) {
+	var s store
+	switch conf.Backend {
+	case BackendNone:
+		return nil, nil
+	case "", BackendMemory:
+		s = newMemory()
+	case BackendRedis:
+		r, err := newRedis(cacheConf)
+		if err != nil {
+			return nil, err
+		}
+		s = r
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend: %v", conf.Backend)
+	}
+
+	l := &Limiter{
+		store:    s,
+		rule:     withDefault(Rule{Rate: conf.Rate, Burst: conf.Burst}, Rule{Rate: defaultRate, Burst: defaultBurst}),
+		commands: make(map[string]Rule, len(conf.Commands)),
+	}
+	for command, rule := range conf.Commands {
+		l.commands[command] = withDefault(Rule{Rate: rule.Rate, Burst: rule.Burst}, l.rule)
+	}
+	return l, nil
+}
+
+// withDefault は設定されていない項目を def で補います
+func withDefault(rule, def Rule) Rule {
+	if rule.Rate <= 0 {
+		rule.Rate = def.Rate
+	}
+	if rule.Burst <= 0 {
+		rule.Burst = def.Burst
+	}
+	return rule
+}
+
+// Allow はコマンドを実行してよいかどうかを返します
+func (l *Limiter) Allow(ctx context.Context, userID, command string) (bool, error) {
+	rule, ok := l.commands[command]
+	if !ok {
+		rule = l.rule
+	}
+	return l.store.take(ctx, command+":"+userID, rule, time.Now())
+}
+
+// Close は共有ストレージへの接続を閉じます
+func (l *Limiter) Close() error {
+	if r, ok := l.store.(*redisStore); ok {
+		return r.client.Close()
+	}
+	return nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // 満タンまで回復する時刻
+}
+
+// memory はプロセス内でバケットを持つ。複数台で動かす場合は台数分だけ緩くなる
+type memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newMemory() *memory {
+	return &memory{
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *memory) take(_ context.Context, key string, rule Rule, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rule.Rate
+	if b.tokens > float64(rule.Burst) {
+		b.tokens = float64(rule.Burst)
+	}
+	b.last = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((float64(rule.Burst) - b.tokens) / rule.Rate * float64(time.Second)))
+	return allowed, nil
+}
+
+// sweep は満タンまで回復したバケットを捨てます。次の実行時に満タンで作り直すので結果は変わらない
+func (m *memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/config"
+)
+
+func TestMemoryTake(t *testing.T) {
+	rule := Rule{Rate: 2, Burst: 3}
+	tests := []struct {
+		name string
+		// 各呼び出しの開始からの経過時間
+		at   []time.Duration
+		want []bool
+	}{
+		{
+			name: "burst",
+			at:   []time.Duration{0, 0, 0, 0},
+			want: []bool{true, true, true, false},
+		},
+		{
+			name: "refill",
+			at:   []time.Duration{0, 0, 0, 0, 500 * time.Millisecond, 500 * time.Millisecond},
+			want: []bool{true, true, true, false, true, false},
+		},
+		{
+			name: "refill is capped at burst",
+			at:   []time.Duration{0, time.Hour, time.Hour, time.Hour, time.Hour},
+			want: []bool{true, true, true, true, false},
+		},
+		{
+			name: "partial refill",
+			at:   []time.Duration{0, 0, 0, 250 * time.Millisecond, 500 * time.Millisecond},
+			want: []bool{true, true, true, false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			m := newMemory()
+			start := time.Now()
+			for i, at := range tt.at {
+				got, err := m.take(ctx, "key", rule, start.Add(at))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want[i] {
+					t.Errorf("take #%v at %v = %v, want %v", i, at, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	ctx := context.Background()
+	m := newMemory()
+	rule := Rule{Rate: 1, Burst: 2}
+	now := time.Now()
+	m.take(ctx, "full", rule, now)
+	m.take(ctx, "empty", rule, now)
+	m.take(ctx, "empty", rule, now)
+	m.take(ctx, "empty", rule, now.Add(sweepInterval))
+
+	m.sweep(now.Add(sweepInterval + 500*time.Millisecond))
+	if _, ok := m.buckets["full"]; ok {
+		t.Error("recovered bucket was not swept")
+	}
+	if _, ok := m.buckets["empty"]; !ok {
+		t.Error("recovering bucket was swept")
+	}
+}
+
+func TestLimiterCommands(t *testing.T) {
+	ctx := context.Background()
+	l, err := New(&config.RateLimit{
+		Burst: 1,
+		Commands: map[string]config.RateLimitRule{
+			"voted": {Burst: 2},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		user, command string
+		want          bool
+	}{
+		{"U1", "list", true},
+		{"U1", "list", false},
+		{"U1", "voted", true},
+		{"U1", "voted", true},
+		{"U1", "voted", false},
+		{"U2", "list", true},
+	}
+	for i, tt := range tests {
+		if got, err := l.Allow(ctx, tt.user, tt.command); err != nil || got != tt.want {
+			t.Errorf("#%v Allow(%v, %v) = %v, %v, want %v", i, tt.user, tt.command, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/mochisuna/linebot-sample/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// キーの接頭辞。キャッシュと同じRedisを使っても衝突しないようにする
+const redisPrefix = "linebot:ratelimit:"
+
+// takeScript はバケットの回復と消費をRedis上でまとめて行います
+// 現在時刻は各サーバーの時計のずれの影響を受けないようRedisの時刻を使う
+// KEYS[1]: キー, ARGV[1]: 1ミリ秒あたりの回復量, ARGV[2]: 上限, ARGV[3]: 有効期限(ミリ秒)
+var takeScript = redis.NewScript(`
+-- Redis 5 より前は TIME の後に書き込むために必要
+if redis.replicate_commands then
+  redis.replicate_commands()
+end
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(bucket[1])
+local last = tonumber(bucket[2])
+if tokens == nil or last == nil then
+  tokens = burst
+  last = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return allowed
+`)
+
+// redisStore は複数台で共有するバケット
+type redisStore struct {
+	client *redis.Client
+}
+
+func newRedis(conf *config.Cache) (*redisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.RedisAddr,
+		Password: conf.RedisPassword,
+		DB:       conf.RedisDB,
+	})
+	// 起動時に接続できることを確認しておく
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &redisStore{client: client}, nil
+}
+
+func (r *redisStore) take(ctx context.Context, key string, rule Rule, _ time.Time) (bool, error) {
+	// 満タンまで回復したバケットは消しても結果が変わらないので、その時間を有効期限にする
+	ttl := int64(math.Ceil(float64(rule.Burst) / rule.Rate * 1000))
+	allowed, err := takeScript.Run(ctx, r.client, []string{redisPrefix + key},
+		rule.Rate/1000, rule.Burst, ttl,
+	).Int()
+	if err != nil {
+		return false, err
+	}
+	return allowed == 1, nil
+}
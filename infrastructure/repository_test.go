@@ -0,0 +1,251 @@
+package infrastructure_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mochisuna/linebot-sample/config"
+	"github.com/mochisuna/linebot-sample/domain"
+	"github.com/mochisuna/linebot-sample/infrastructure"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/infrastructure/migration"
+)
+
+// testDBConfig はドライバごとのテスト用データベースの設定を返します
+// mysql と postgres は LINEBOT_TEST_<DRIVER>_HOST などが設定されている場合のみ使い、テストのたびにスキーマを作り直す
+func testDBConfig(t *testing.T, driver string) *config.DB {
+	t.Helper()
+	if driver == db.DriverSQLite {
+		return &config.DB{Driver: driver, Path: filepath.Join(t.TempDir(), "test.db")}
+	}
+	prefix := "LINEBOT_TEST_" + strings.ToUpper(driver) + "_"
+	host := os.Getenv(prefix + "HOST")
+	if host == "" {
+		t.Skipf("%vHOST is not set", prefix)
+	}
+	return &config.DB{
+		Driver:   driver,
+		Host:     host,
+		Port:     os.Getenv(prefix + "PORT"),
+		User:     os.Getenv(prefix + "USER"),
+		Password: os.Getenv(prefix + "PASSWORD"),
+		DBName:   os.Getenv(prefix + "DBNAME"),
+	}
+}
+
+// newTestDB はドライバのマイグレーションを全て適用したデータベースを返します
+func newTestDB(t *testing.T, driver string) *db.Client {
+	t.Helper()
+	ctx := context.Background()
+	client, err := db.New(testDBConfig(t, driver))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	migrator, err := migration.New(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Down(ctx, len(statuses)); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// forEachDriver はドライバごとに fn を実行します
+func forEachDriver(t *testing.T, fn func(t *testing.T, client *db.Client)) {
+	for _, driver := range []string{db.DriverSQLite, db.DriverMySQL, db.DriverPostgres} {
+		driver := driver
+		t.Run(driver, func(t *testing.T) {
+			fn(t, newTestDB(t, driver))
+		})
+	}
+}
+
+func createEvent(t *testing.T, client *db.Client, id domain.EventID, owner domain.OwnerID, joinCode string) *domain.Event {
+	t.Helper()
+	event := &domain.Event{
+		ID:        id,
+		OwnerID:   owner,
+		Status:    domain.EVENT_OPEN,
+		Title:     "title " + string(id),
+		JoinCode:  joinCode,
+		CreatedAt: 100,
+		UpdatedAt: 100,
+	}
+	if err := infrastructure.NewEventRepository(client, client).Create(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestEventRepository(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, client *db.Client) {
+		ctx := context.Background()
+		repo := infrastructure.NewEventRepository(client, client)
+		want := createEvent(t, client, "e1", "Uowner", "123456")
+
+		got, err := repo.SelectByEventID(ctx, want.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != *want {
+			t.Errorf("SelectByEventID() = %+v, want %+v", got, want)
+		}
+		if got, err := repo.SelectByJoinCode(ctx, "123456"); err != nil || got.ID != want.ID {
+			t.Errorf("SelectByJoinCode() = %+v, %v", got, err)
+		}
+
+		// 終了したイベントの参加コードは使えない
+		want.Status = domain.EVENT_CLOSED
+		want.UpdatedAt = 200
+		if err := repo.Update(ctx, want); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.SelectByJoinCode(ctx, "123456"); err != sql.ErrNoRows {
+			t.Errorf("SelectByJoinCode(closed) error = %v, want sql.ErrNoRows", err)
+		}
+		if count, err := repo.CountByStatus(ctx, domain.EVENT_CLOSED); err != nil || count != 1 {
+			t.Errorf("CountByStatus(closed) = %v, %v, want 1", count, err)
+		}
+	})
+}
+
+func TestUserRepository(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, client *db.Client) {
+		ctx := context.Background()
+		tx := infrastructure.NewTxManager(client)
+		repo := infrastructure.NewUserRepository(client, client)
+		e1 := createEvent(t, client, "e1", "Uowner", "111111")
+		e2 := createEvent(t, client, "e2", "Uowner", "222222")
+		userID := domain.UserID("Uuser")
+
+		participate := func(eventID domain.EventID, now int) error {
+			return tx.Do(ctx, func(ctx context.Context) error {
+				return repo.Participate(ctx, &domain.User{ID: userID, EventID: eventID, IsParticipated: true, CreatedAt: now, UpdatedAt: now})
+			})
+		}
+		if err := participate(e1.ID, 100); err != nil {
+			t.Fatal(err)
+		}
+		user, err := repo.SelectByIDAndStatus(ctx, &userID, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.EventID != e1.ID {
+			t.Errorf("SelectByIDAndStatus() = %+v, want participating in %v", user, e1.ID)
+		}
+		if err := participate(e2.ID, 110); err != domain.ErrAlreadyParticipating {
+			t.Errorf("Participate(another event) error = %v, want %v", err, domain.ErrAlreadyParticipating)
+		}
+
+		// 投票は参加中に作られた枠に記録される
+		if err := repo.Vote(ctx, &domain.User{ID: userID, EventID: e1.ID, Vote: domain.GOOD, UpdatedAt: 120}); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.SelectVote(ctx, &userID, &e1.ID); err != nil || got.Vote != domain.GOOD {
+			t.Errorf("SelectVote() = %+v, %v, want %v", got, err, domain.GOOD)
+		}
+
+		if err := repo.LeaveByEventID(ctx, e1.ID, 130); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.Select(ctx, &userID, &e1.ID); err != nil || got.IsParticipated {
+			t.Errorf("Select() after leave = %+v, %v, want left", got, err)
+		}
+		if count, err := repo.CountParticipants(ctx); err != nil || count != 0 {
+			t.Errorf("CountParticipants() after leave = %v, %v, want 0", count, err)
+		}
+
+		// 離脱後は別のイベントに参加でき、戻っても投票は引き継がれる
+		if err := participate(e2.ID, 140); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Update(ctx, &domain.User{ID: userID, EventID: e2.ID, IsParticipated: false, UpdatedAt: 150}); err != nil {
+			t.Fatal(err)
+		}
+		if err := participate(e1.ID, 160); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.SelectVote(ctx, &userID, &e1.ID); err != nil || got.Vote != domain.GOOD {
+			t.Errorf("SelectVote() after rejoin = %+v, %v, want %v", got, err, domain.GOOD)
+		}
+	})
+}
+
+func TestOrganizerRepository(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, client *db.Client) {
+		ctx := context.Background()
+		repo := infrastructure.NewOrganizerRepository(client, client)
+		owners := infrastructure.NewOwnerRepository(client, client)
+		event := createEvent(t, client, "e1", "Uowner", "111111")
+
+		if err := owners.Create(ctx, &domain.Owner{ID: "Uco", DisplayName: "co", CreatedAt: 100, UpdatedAt: 100}); err != nil {
+			t.Fatal(err)
+		}
+		co := &domain.Organizer{EventID: event.ID, OwnerID: "Uco", Role: domain.ORGANIZER_CO, CreatedAt: 110, UpdatedAt: 110}
+		if err := repo.Create(ctx, co); err != nil {
+			t.Fatal(err)
+		}
+
+		// イベントの作成者は主催者として登録されている
+		if got, err := repo.Select(ctx, event.ID, event.OwnerID); err != nil || got.Role != domain.ORGANIZER_PRIMARY {
+			t.Errorf("Select(owner) = %+v, %v", got, err)
+		}
+		list, err := repo.SelectList(ctx, event.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := map[domain.OwnerID]string{}
+		for _, o := range list {
+			names[o.OwnerID] = o.DisplayName
+		}
+		if len(names) != 2 || names["Uco"] != "co" || names["Uowner"] != "" {
+			t.Errorf("SelectList() display names = %v", names)
+		}
+
+		if err := repo.Delete(ctx, co); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Select(ctx, event.ID, co.OwnerID); err != sql.ErrNoRows {
+			t.Errorf("Select(deleted) error = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestInvitation(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, client *db.Client) {
+		ctx := context.Background()
+		repo := infrastructure.NewOrganizerRepository(client, client)
+		event := createEvent(t, client, "e1", "Uowner", "111111")
+
+		want := &domain.Invitation{Code: "invite", EventID: event.ID, OwnerID: event.OwnerID, CreatedAt: 100, UpdatedAt: 100}
+		if err := repo.CreateInvitation(ctx, want); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.SelectInvitation(ctx, want.Code); err != nil || *got != *want {
+			t.Errorf("SelectInvitation() = %+v, %v, want %+v", got, err, want)
+		}
+		if got, err := repo.SelectInvitationByEventID(ctx, event.ID); err != nil || *got != *want {
+			t.Errorf("SelectInvitationByEventID() = %+v, %v, want %+v", got, err, want)
+		}
+
+		if err := repo.DeleteInvitation(ctx, event.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.SelectInvitation(ctx, want.Code); err != sql.ErrNoRows {
+			t.Errorf("SelectInvitation(deleted) error = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
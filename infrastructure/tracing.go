@@ -0,0 +1,98 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// クエリの実行先
+const (
+	targetMaster      = "master"
+	targetReplica     = "replica"
+	targetTransaction = "transaction"
+)
+
+// tracedRunner はクエリごとにスパンを記録します
+// 値に個人情報が含まれるため、スパンにはSQL文のみを記録し引数は記録しない
+type tracedRunner struct {
+	runner squirrel.StdSqlCtx
+	driver string
+	target string
+}
+
+// placeholder はクエリビルダーが生成した ? をデータベースに合わせた形式に変換します
+func (r *tracedRunner) placeholder(query string) (string, error) {
+	if r.driver == db.DriverPostgres {
+		return squirrel.Dollar.ReplacePlaceholders(query)
+	}
+	return query, nil
+}
+
+func (r *tracedRunner) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := query
+	if i := strings.IndexAny(query, " \n"); i > 0 {
+		operation = query[:i]
+	}
+	return tracing.Start(ctx, "SQL "+strings.ToUpper(operation),
+		attribute.String("db.system", r.driver),
+		attribute.String("db.statement", query),
+		attribute.String("db.target", r.target),
+	)
+}
+
+func (r *tracedRunner) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return r.ExecContext(context.Background(), query, args...)
+}
+
+func (r *tracedRunner) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return r.QueryContext(context.Background(), query, args...)
+}
+
+func (r *tracedRunner) QueryRow(query string, args ...interface{}) *sql.Row {
+	return r.QueryRowContext(context.Background(), query, args...)
+}
+
+func (r *tracedRunner) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, err := r.placeholder(query)
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := r.start(ctx, query)
+	res, err := r.runner.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return res, err
+}
+
+func (r *tracedRunner) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query, err := r.placeholder(query)
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := r.start(ctx, query)
+	rows, err := r.runner.QueryContext(ctx, query, args...)
+	tracing.End(span, err)
+	return rows, err
+}
+
+func (r *tracedRunner) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	// *sql.Row はエラーを持たせて生成できないため、変換できない場合はそのまま実行してエラーを返させる
+	if converted, err := r.placeholder(query); err == nil {
+		query = converted
+	}
+	ctx, span := r.start(ctx, query)
+	row := r.runner.QueryRowContext(ctx, query, args...)
+	// 該当なしは想定内のためエラーとして記録しない
+	if err := row.Err(); err != sql.ErrNoRows {
+		tracing.End(span, err)
+	} else {
+		span.End()
+	}
+	return row
+}
@@ -0,0 +1,98 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/mochisuna/linebot-sample/domain/repository"
+	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/tracing"
+)
+
+type txKey struct{}
+
+type txManager struct {
+	dbm *db.Client
+}
+
+func NewTxManager(dbmClient *db.Client) repository.TxManager {
+	return &txManager{
+		dbm: dbmClient,
+	}
+}
+
+func (m *txManager) Do(ctx context.Context, fn func(context.Context) error) error {
+	return withTx(ctx, m.dbm, fn)
+}
+
+// txState は実行中のトランザクションとコミット後に実行する処理
+type txState struct {
+	tx          *sql.Tx
+	afterCommit []func()
+}
+
+// afterCommit はトランザクション中であればコミット後に、そうでなければすぐに fn を実行します
+// ロールバックされた場合は実行しません
+func afterCommit(ctx context.Context, fn func()) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		state.afterCommit = append(state.afterCommit, fn)
+		return
+	}
+	fn()
+}
+
+// inTx はトランザクション中かどうかを返します
+func inTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*txState)
+	return ok
+}
+
+// withTx は ctx にトランザクションがあればそれに参加し、なければマスターで新しく開始します
+func withTx(ctx context.Context, dbm *db.Client, fn func(context.Context) error) (err error) {
+	if inTx(ctx) {
+		return fn(ctx)
+	}
+	ctx, span := tracing.Start(ctx, "SQL transaction")
+	defer func() {
+		tracing.End(span, err)
+	}()
+	tx, err := dbm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	state := &txState{tx: tx}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p) // re-throw panic after Rollback
+		} else if err != nil {
+			tx.Rollback()
+		} else if err = tx.Commit(); err == nil {
+			for _, hook := range state.afterCommit {
+				hook()
+			}
+		}
+	}()
+	err = fn(context.WithValue(ctx, txKey{}, state))
+	if err == nil {
+		// 直後の読み込みがレプリカ遅延で古い値を返さないよう、このユーザーの読み込みをしばらくマスターへ向ける
+		dbm.MarkWrite(repository.ActorFromContext(ctx))
+	}
+	return err
+}
+
+// runner はトランザクション中であればそのトランザクションを、そうでなければ指定されたDBを返します
+// レプリカが指定された場合でも、context で要求されたときやユーザーの書き込み直後はマスターを返します
+func runner(ctx context.Context, client *db.Client) squirrel.BaseRunner {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return &tracedRunner{runner: state.tx, driver: client.Driver, target: targetTransaction}
+	}
+	if primary := client.Primary(); primary != nil {
+		if repository.IsPrimary(ctx) || primary.WroteRecently(repository.ActorFromContext(ctx)) {
+			return &tracedRunner{runner: primary.DB, driver: primary.Driver, target: targetMaster}
+		}
+		return &tracedRunner{runner: client.DB, driver: client.Driver, target: targetReplica}
+	}
+	return &tracedRunner{runner: client.DB, driver: client.Driver, target: targetMaster}
+}
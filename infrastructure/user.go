@@ -2,13 +2,12 @@ package infrastructure
 
 import (
 	"context"
-	"database/sql"
-	"log"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/mochisuna/linebot-sample/domain"
 	"github.com/mochisuna/linebot-sample/domain/repository"
 	"github.com/mochisuna/linebot-sample/infrastructure/db"
+	"github.com/mochisuna/linebot-sample/logger"
 )
 
 type userRepository struct {
@@ -23,28 +22,8 @@ func NewUserRepository(dbmClient *db.Client, dbsClient *db.Client) repository.Us
 	}
 }
 
-// TODO 共通化
-func (r *userRepository) WithTransaction(ctx context.Context, txFunc func(*sql.Tx) error) error {
-	tx, err := r.dbm.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if p := recover(); p != nil {
-			tx.Rollback()
-			panic(p) // re-throw panic after Rollback
-		} else if err != nil {
-			tx.Rollback()
-		} else {
-			err = tx.Commit()
-		}
-	}()
-	err = txFunc(tx)
-	return err
-}
-
-func (r *userRepository) Select(userID *domain.UserID, eventID *domain.EventID) (*domain.User, error) {
-	log.Println("called infrastructure.user Select")
+func (r *userRepository) Select(ctx context.Context, userID *domain.UserID, eventID *domain.EventID) (*domain.User, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.user Select")
 	var col eventParticipantsColumns
 	err := squirrel.Select("user_id", "event_id", "is_participated", "created_at", "updated_at").
 		From(EVENT_PARTICIPANTS).
@@ -52,8 +31,8 @@ func (r *userRepository) Select(userID *domain.UserID, eventID *domain.EventID)
 			"user_id":  *userID,
 			"event_id": *eventID,
 		}).
-		RunWith(r.dbs.DB).
-		QueryRow().
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
 		Scan(
 			&col.UserID,
 			&col.EventID,
@@ -70,8 +49,8 @@ func (r *userRepository) Select(userID *domain.UserID, eventID *domain.EventID)
 	}, err
 }
 
-func (r *userRepository) SelectByIDAndStatus(userID *domain.UserID, isParticipated bool) (*domain.User, error) {
-	log.Println("called infrastructure.user SelectByIDAndStatus")
+func (r *userRepository) SelectByIDAndStatus(ctx context.Context, userID *domain.UserID, isParticipated bool) (*domain.User, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.user SelectByIDAndStatus")
 	var col eventParticipantsColumns
 	err := squirrel.Select("user_id", "event_id", "is_participated", "created_at", "updated_at").
 		From(EVENT_PARTICIPANTS).
@@ -79,8 +58,8 @@ func (r *userRepository) SelectByIDAndStatus(userID *domain.UserID, isParticipat
 			"user_id":         *userID,
 			"is_participated": isParticipated,
 		}).
-		RunWith(r.dbs.DB).
-		QueryRow().
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
 		Scan(
 			&col.UserID,
 			&col.EventID,
@@ -97,8 +76,131 @@ func (r *userRepository) SelectByIDAndStatus(userID *domain.UserID, isParticipat
 	}, err
 }
 
-func (r *userRepository) Update(user *domain.User, tx *sql.Tx) error {
-	log.Println("called infrastructure.user Update")
+// 主催中のイベントと参加中のイベントを区別するための値
+const (
+	contextOrganizer   = "organizer"
+	contextParticipant = "participant"
+)
+
+// SelectContext は主催中のイベントと参加中のイベント、現在の投票を1回のクエリでまとめて取得します
+// どちらにも該当しない場合は ROLE_GUEST の UserContext を返します
+func (r *userRepository) SelectContext(ctx context.Context, userID domain.UserID) (*domain.UserContext, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.user SelectContext")
+	// 参加中のイベントと投票
+	participant, args, err := squirrel.Select(
+		"'"+contextParticipant+"'", "es.event_id", "es.owner_id", "es.status", "es.title", "es.join_code", "es.is_private", "es.passcode", "es.is_voting", "es.vote_closes_at", "es.vote_opened_at", "es.vote_policy", "es.opened_at", "es.created_at", "es.updated_at",
+		"0", "COALESCE(ev.vote, 0)", "ep.created_at", "ep.updated_at",
+	).
+		From(EVENT_PARTICIPANTS + " AS ep").
+		Join(EVENT_STATUSES + " AS es ON es.event_id = ep.event_id").
+		LeftJoin(EVENT_VOTES + " AS ev ON ev.user_id = ep.user_id AND ev.event_id = ep.event_id").
+		Where(squirrel.Eq{
+			"ep.user_id":         userID,
+			"ep.is_participated": true,
+		}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	// 主催中のイベント
+	rows, err := squirrel.Select(
+		"'"+contextOrganizer+"'", "es.event_id", "es.owner_id", "es.status", "es.title", "es.join_code", "es.is_private", "es.passcode", "es.is_voting", "es.vote_closes_at", "es.vote_opened_at", "es.vote_policy", "es.opened_at", "es.created_at", "es.updated_at",
+		"eo.role", "0", "eo.created_at", "eo.updated_at",
+	).
+		From(EVENT_STATUSES+" AS es").
+		Join(EVENT_ORGANIZERS+" AS eo ON eo.event_id = es.event_id").
+		Where(squirrel.Eq{
+			"eo.owner_id": userID,
+			"es.status":   domain.EVENT_OPEN,
+		}).
+		Suffix("UNION ALL "+participant, args...).
+		RunWith(runner(ctx, r.dbs)).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uc := &domain.UserContext{
+		UserID: userID,
+		Role:   domain.ROLE_GUEST,
+	}
+	for rows.Next() {
+		var kind string
+		var event eventStatusColumns
+		var role domain.OrganizerRole
+		var vote domain.VOTE_STATUS
+		var createdAt, updatedAt int
+		err := rows.Scan(
+			&kind,
+			&event.EventID,
+			&event.OwnerID,
+			&event.Status,
+			&event.Title,
+			&event.JoinCode,
+			&event.IsPrivate,
+			&event.Passcode,
+			&event.IsVoting,
+			&event.VoteClosesAt,
+			&event.VoteOpenedAt,
+			&event.VotePolicy,
+			&event.OpenedAt,
+			&event.CreatedAt,
+			&event.UpdatedAt,
+			&role,
+			&vote,
+			&createdAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ev := &domain.Event{
+			ID:           event.EventID,
+			OwnerID:      event.OwnerID,
+			Status:       event.Status,
+			Title:        event.Title,
+			JoinCode:     event.JoinCode.String,
+			IsPrivate:    event.IsPrivate,
+			Passcode:     event.Passcode.String,
+			IsVoting:     event.IsVoting,
+			VoteClosesAt: event.VoteClosesAt,
+			VoteOpenedAt: event.VoteOpenedAt,
+			VotePolicy:   event.VotePolicy,
+			OpenedAt:     event.OpenedAt,
+			CreatedAt:    event.CreatedAt,
+			UpdatedAt:    event.UpdatedAt,
+		}
+		switch kind {
+		case contextOrganizer:
+			uc.OwnedEvent = ev
+			uc.Role = domain.ROLE_CO_ORGANIZER
+			if role == domain.ORGANIZER_PRIMARY {
+				uc.Role = domain.ROLE_OWNER
+			}
+		case contextParticipant:
+			uc.ParticipatedEvent = ev
+			uc.Participation = &domain.User{
+				ID:             userID,
+				EventID:        ev.ID,
+				IsParticipated: true,
+				Vote:           vote,
+				CreatedAt:      createdAt,
+				UpdatedAt:      updatedAt,
+			}
+			if uc.OwnedEvent == nil {
+				uc.Role = domain.ROLE_PARTICIPANT
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return uc, nil
+}
+
+func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
+	logger.FromContext(ctx).Debug("called infrastructure.user Update")
 	_, err := squirrel.Update(EVENT_PARTICIPANTS).
 		SetMap(squirrel.Eq{
 			"is_participated": user.IsParticipated,
@@ -108,34 +210,70 @@ func (r *userRepository) Update(user *domain.User, tx *sql.Tx) error {
 			"user_id":  user.ID,
 			"event_id": user.EventID,
 		}).
-		RunWith(tx).
-		Exec()
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
 	return err
 }
 
-func (r *userRepository) Participate(user *domain.User, tx *sql.Tx) error {
-	log.Println("called infrastructure.user Participate")
-	_, err := squirrel.Insert(EVENT_PARTICIPANTS).
-		Columns("event_id", "user_id", "is_participated", "created_at", "updated_at").
-		Values(user.EventID, user.ID, user.IsParticipated, user.CreatedAt, user.UpdatedAt).
-		RunWith(tx).
-		Exec()
-	if err != nil {
-		return err
+// Participate は参加情報をupsertします。投票枠は過去に参加していた場合そのまま引き継ぎます
+// 既に参加中の場合は一意制約により domain.ErrAlreadyParticipated または domain.ErrAlreadyParticipating を返します
+func (r *userRepository) Participate(ctx context.Context, user *domain.User) error {
+	logger.FromContext(ctx).Debug("called infrastructure.user Participate")
+	// 参加と投票枠の作成はまとめてコミットする
+	return withTx(ctx, r.dbm, func(ctx context.Context) error {
+		// ON DUPLICATE KEY UPDATE は参加中ユーザーの一意制約にも反応して別イベントの行を更新してしまうので使わない
+		res, err := squirrel.Update(EVENT_PARTICIPANTS).
+			SetMap(squirrel.Eq{
+				"is_participated": user.IsParticipated,
+				"updated_at":      user.UpdatedAt,
+			}).
+			Where(squirrel.Eq{
+				"user_id":  user.ID,
+				"event_id": user.EventID,
+			}).
+			RunWith(runner(ctx, r.dbm)).
+			ExecContext(ctx)
+		if err != nil {
+			return participateError(err)
+		}
+		if affected, err := res.RowsAffected(); err != nil {
+			return err
+		} else if affected < 1 {
+			_, err = squirrel.Insert(EVENT_PARTICIPANTS).
+				Columns("event_id", "user_id", "is_participated", "created_at", "updated_at").
+				Values(user.EventID, user.ID, user.IsParticipated, user.CreatedAt, user.UpdatedAt).
+				RunWith(runner(ctx, r.dbm)).
+				ExecContext(ctx)
+			if err != nil {
+				return participateError(err)
+			}
+		}
+		_, err = squirrel.Insert(EVENT_VOTES).
+			Columns("user_id", "event_id", "vote", "created_at", "updated_at").
+			Values(user.ID, user.EventID, domain.NOT_VOTED, user.CreatedAt, user.UpdatedAt).
+			Suffix(ignoreDuplicate(r.dbm, "event_id")).
+			RunWith(runner(ctx, r.dbm)).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// participateError は参加時の一意制約違反をドメインのエラーに変換します
+func participateError(err error) error {
+	if isDuplicateKey(err, "uniq_active_user_id") {
+		return domain.ErrAlreadyParticipating
 	}
-	_, err = squirrel.Insert(EVENT_VOTES).
-		Columns("user_id", "event_id", "vote", "created_at", "updated_at").
-		Values(user.ID, user.EventID, domain.NOT_VOTED, user.CreatedAt, user.UpdatedAt).
-		RunWith(tx).
-		Exec()
-	if err != nil {
-		return err
+	if isDuplicateKey(err, "PRIMARY") {
+		return domain.ErrAlreadyParticipated
 	}
-	return nil
+	return err
 }
 
-func (r *userRepository) Vote(user *domain.User, tx *sql.Tx) error {
-	log.Println("called infrastructure.user Vote")
+func (r *userRepository) Vote(ctx context.Context, user *domain.User) error {
+	logger.FromContext(ctx).Debug("called infrastructure.user Vote")
 	_, err := squirrel.Update(EVENT_VOTES).
 		SetMap(squirrel.Eq{
 			"vote":       user.Vote,
@@ -145,7 +283,215 @@ func (r *userRepository) Vote(user *domain.User, tx *sql.Tx) error {
 			"user_id":  user.ID,
 			"event_id": user.EventID,
 		}).
-		RunWith(tx).
-		Exec()
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
+	return err
+}
+
+// SelectVote は現在の投票を返します
+// 投票の変更可否の判定に使うため、トランザクション内ではマスターから参照する
+func (r *userRepository) SelectVote(ctx context.Context, userID *domain.UserID, eventID *domain.EventID) (*domain.User, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.user SelectVote")
+	var col eventVotesColumns
+	err := squirrel.Select("event_id", "vote", "created_at", "updated_at").
+		From(EVENT_VOTES).
+		Where(squirrel.Eq{
+			"user_id":  *userID,
+			"event_id": *eventID,
+		}).
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
+		Scan(
+			&col.EventID,
+			&col.Vote,
+			&col.CreatedAt,
+			&col.UpdatedAt,
+		)
+	return &domain.User{
+		ID:        *userID,
+		EventID:   col.EventID,
+		Vote:      col.Vote,
+		CreatedAt: col.CreatedAt,
+		UpdatedAt: col.UpdatedAt,
+	}, err
+}
+
+// CreateVoteHistory は投票の変更を履歴に追加します
+func (r *userRepository) CreateVoteHistory(ctx context.Context, history *domain.VoteHistory) error {
+	logger.FromContext(ctx).Debug("called infrastructure.user CreateVoteHistory")
+	_, err := squirrel.Insert(VOTE_HISTORIES).
+		Columns("event_id", "user_id", "vote", "previous_vote", "created_at").
+		Values(history.EventID, history.UserID, history.Vote, history.PreviousVote, history.CreatedAt).
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
+	return err
+}
+
+// SelectVoteHistories はイベントの投票の変更履歴を古い順に返します
+func (r *userRepository) SelectVoteHistories(ctx context.Context, eventID domain.EventID) ([]domain.VoteHistory, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.user SelectVoteHistories")
+	rows, err := squirrel.Select("event_id", "user_id", "vote", "previous_vote", "created_at").
+		From(VOTE_HISTORIES).
+		Where(squirrel.Eq{
+			"event_id": eventID,
+		}).
+		OrderBy("created_at ASC", "id ASC").
+		RunWith(runner(ctx, r.dbs)).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []domain.VoteHistory
+	for rows.Next() {
+		var col eventVoteHistoriesColumns
+		err := rows.Scan(
+			&col.EventID,
+			&col.UserID,
+			&col.Vote,
+			&col.PreviousVote,
+			&col.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, domain.VoteHistory{
+			EventID:      col.EventID,
+			UserID:       col.UserID,
+			Vote:         col.Vote,
+			PreviousVote: col.PreviousVote,
+			CreatedAt:    col.CreatedAt,
+		})
+	}
+	return ret, rows.Err()
+}
+
+// SelectVotes はイベントの全員の現在の投票を返します
+func (r *userRepository) SelectVotes(ctx context.Context, eventID domain.EventID) ([]domain.User, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.user SelectVotes")
+	rows, err := squirrel.Select("user_id", "vote", "created_at", "updated_at").
+		From(EVENT_VOTES).
+		Where(squirrel.Eq{
+			"event_id": eventID,
+		}).
+		RunWith(runner(ctx, r.dbs)).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []domain.User
+	for rows.Next() {
+		var col eventVotesColumns
+		var userID domain.UserID
+		if err := rows.Scan(&userID, &col.Vote, &col.CreatedAt, &col.UpdatedAt); err != nil {
+			return nil, err
+		}
+		ret = append(ret, domain.User{
+			ID:        userID,
+			EventID:   eventID,
+			Vote:      col.Vote,
+			CreatedAt: col.CreatedAt,
+			UpdatedAt: col.UpdatedAt,
+		})
+	}
+	return ret, rows.Err()
+}
+
+// SelectParticipants は離脱したユーザーも含めてイベントの参加者を返します
+// 離脱したユーザーの updated_at は離脱した時刻になる
+func (r *userRepository) SelectParticipants(ctx context.Context, eventID domain.EventID) ([]domain.User, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.user SelectParticipants")
+	rows, err := squirrel.Select("user_id", "event_id", "is_participated", "created_at", "updated_at").
+		From(EVENT_PARTICIPANTS).
+		Where(squirrel.Eq{
+			"event_id": eventID,
+		}).
+		RunWith(runner(ctx, r.dbs)).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []domain.User
+	for rows.Next() {
+		var col eventParticipantsColumns
+		err := rows.Scan(
+			&col.UserID,
+			&col.EventID,
+			&col.IsParticipated,
+			&col.CreatedAt,
+			&col.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, domain.User{
+			ID:             col.UserID,
+			EventID:        col.EventID,
+			IsParticipated: col.IsParticipated,
+			CreatedAt:      col.CreatedAt,
+			UpdatedAt:      col.UpdatedAt,
+		})
+	}
+	return ret, rows.Err()
+}
+
+// LeaveByEventID はイベントの参加者を全員離脱させます
+func (r *userRepository) LeaveByEventID(ctx context.Context, eventID domain.EventID, updatedAt int) error {
+	logger.FromContext(ctx).Debug("called infrastructure.user LeaveByEventID")
+	_, err := squirrel.Update(EVENT_PARTICIPANTS).
+		SetMap(squirrel.Eq{
+			"is_participated": false,
+			"updated_at":      updatedAt,
+		}).
+		Where(squirrel.Eq{
+			"event_id":        eventID,
+			"is_participated": true,
+		}).
+		RunWith(runner(ctx, r.dbm)).
+		ExecContext(ctx)
 	return err
 }
+
+// CountParticipants はイベントに参加中のユーザー数を返します
+func (r *userRepository) CountParticipants(ctx context.Context) (int, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.user CountParticipants")
+	var count int
+	err := squirrel.Select("COUNT(*)").
+		From(EVENT_PARTICIPANTS).
+		Where(squirrel.Eq{
+			"is_participated": true,
+		}).
+		RunWith(runner(ctx, r.dbs)).
+		QueryRowContext(ctx).
+		Scan(&count)
+	return count, err
+}
+
+// SelectParticipantIDs はイベントに参加中のユーザーのIDを返します
+func (r *userRepository) SelectParticipantIDs(ctx context.Context, eventID domain.EventID) ([]domain.UserID, error) {
+	logger.FromContext(ctx).Debug("called infrastructure.user SelectParticipantIDs")
+	rows, err := squirrel.Select("user_id").
+		From(EVENT_PARTICIPANTS).
+		Where(squirrel.Eq{
+			"event_id":        eventID,
+			"is_participated": true,
+		}).
+		OrderBy("user_id").
+		RunWith(runner(ctx, r.dbs)).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []domain.UserID
+	for rows.Next() {
+		var userID domain.UserID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		ret = append(ret, userID)
+	}
+	return ret, rows.Err()
+}
@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mochisuna/linebot-sample/config"
+)
+
+type loggerKey struct{}
+
+const redacted = "[REDACTED]"
+
+// ログに出さない項目
+var redactKeys = map[string]bool{
+	"display_name": true,
+	"passcode":     true,
+	"text":         true,
+	"token":        true,
+	"reply_token":  true,
+}
+
+// LINEのユーザーIDはU + 32桁の16進数
+var lineIDPattern = regexp.MustCompile(`U[0-9a-f]{32}`)
+
+var salt []byte
+
+// New は設定に従ってJSON形式で出力するロガーを生成します
+func New(conf *config.Log) *slog.Logger {
+	return newLogger(os.Stdout, conf)
+}
+
+func newLogger(w io.Writer, conf *config.Log) *slog.Logger {
+	salt = []byte(conf.HashSalt)
+	opts := &slog.HandlerOptions{
+		Level: parseLevel(conf.Level),
+	}
+	if conf.RedactPII {
+		opts.ReplaceAttr = redact
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// redact は個人情報にあたる項目を伏せ、文字列中のLINEユーザーIDはハッシュに置き換えます
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if redactKeys[a.Key] {
+		return slog.String(a.Key, redacted)
+	}
+	var v string
+	switch a.Value.Kind() {
+	case slog.KindString:
+		v = a.Value.String()
+	case slog.KindAny:
+		// エラーメッセージにIDが含まれることがあるため文字列にしてから確認する
+		err, ok := a.Value.Any().(error)
+		if !ok {
+			return a
+		}
+		v = err.Error()
+	default:
+		return a
+	}
+	if lineIDPattern.MatchString(v) {
+		return slog.String(a.Key, lineIDPattern.ReplaceAllStringFunc(v, HashUserID))
+	}
+	return a
+}
+
+// HashUserID はLINEユーザーIDをログで突き合わせられる形のハッシュにします
+func HashUserID(userID string) string {
+	if userID == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// WithContext はロガーを context に設定します
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext は context に設定されたロガーを返します。設定されていない場合は既定のロガーを返します
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// With は context のロガーに項目を追加した context を返します
+func With(ctx context.Context, args ...interface{}) context.Context {
+	return WithContext(ctx, FromContext(ctx).With(args...))
+}
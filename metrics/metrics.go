@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "linebot"
+
+// Registry は /metrics で公開するメトリクスの登録先
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// WebhookEvents は受信したwebhookイベント数
+	WebhookEvents = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_total",
+		Help:      "Number of webhook events received.",
+	}, []string{"type", "command"})
+
+	// CommandResults はコマンドの処理結果。result は success または失敗の種類
+	CommandResults = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "command_results_total",
+		Help:      "Number of handled commands by result.",
+	}, []string{"command", "result"})
+
+	// CommandDuration はwebhookイベント1件あたりの処理時間
+	CommandDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "command_duration_seconds",
+		Help:      "Time spent handling a webhook event.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command"})
+
+	// HTTPDuration はHTTPリクエストの処理時間
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time spent serving HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// DBQueryDuration はリポジトリのメソッドごとの処理時間
+	DBQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time spent in repository methods.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"repository", "method"})
+
+	// DBQueryErrors はリポジトリのメソッドごとのエラー数
+	DBQueryErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Number of repository method errors.",
+	}, []string{"repository", "method"})
+
+	// CacheRequests はキャッシュの参照結果。result は hit, miss, error
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Number of cache lookups by result.",
+	}, []string{"cache", "result"})
+
+	// LineAPIDuration はLINE APIの呼び出し時間
+	LineAPIDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "line_api_duration_seconds",
+		Help:      "Time spent calling the LINE Messaging API.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler は /metrics 用のハンドラを返します
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ユーザーIDやメッセージIDなどパスに含まれるIDはラベルの種類が増えないようにまとめる
+var pathIDPattern = regexp.MustCompile(`^[0-9A-Za-z_-]*[0-9][0-9A-Za-z_-]{8,}$`)
+
+// Endpoint はラベルに使うため、APIのパスからIDを取り除きます
+func Endpoint(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if pathIDPattern.MatchString(segment) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+type lineTransport struct {
+	base http.RoundTripper
+}
+
+// NewLineTransport はLINE APIの呼び出し時間とステータスコードを記録する RoundTripper を返します
+func NewLineTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &lineTransport{base: base}
+}
+
+func (t *lineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	LineAPIDuration.WithLabelValues(Endpoint(req.URL.Path), status).Observe(time.Since(start).Seconds())
+	return res, err
+}